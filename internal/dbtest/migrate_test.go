@@ -2,11 +2,18 @@ package dbtest_test
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
 	"github.com/uptrace/bun/migrate"
 )
 
@@ -18,6 +25,37 @@ func TestMigrate(t *testing.T) {
 	tests := []Test{
 		{run: testMigrateUpAndDown},
 		{run: testMigrateUpError},
+		{run: testMigrateEmpty},
+		{run: testMigrateTableComment},
+		{run: testMigrateDryRun},
+		{run: testMigrateAuthor},
+		{run: testMigrateUpgradeTable},
+		{run: testMigrateDependsOn},
+		{run: testMigrateSkip},
+		{run: testRollbackTo},
+		{run: testMigrateAdvisoryLock},
+		{run: testMigrateDataBackup},
+		{run: testMigrateDataBackupWithoutDown},
+		{run: testMigrateStatus},
+		{run: testMigrateHooks},
+		{run: testMigrateTransactions},
+		{run: testMigrateTransactionsGo},
+		{run: testMigrateSquash},
+		{run: testMigrateSquashApplied},
+		{run: testMigrateSquashKeepOriginals},
+		{run: testMigrateSquashOtherFS},
+		{run: testMigrateSquashTx},
+		{run: testMigrateDuration},
+		{run: testMigrateBaseline},
+		{run: testMigrateLockTimeout},
+		{run: testMigrateComment},
+		{run: testMigrateOne},
+		{run: testMigrateTableSchema},
+		{run: testMigrateLockCallbacks},
+		{run: testMigrateSeed},
+		{run: testMigrateSteps},
+		{run: testMigratePrePostHooks},
+		{run: testMigrateDisableTransaction},
 	}
 
 	testEachDB(t, func(t *testing.T, dbName string, db *bun.DB) {
@@ -122,7 +160,13 @@ func testMigrateUpError(t *testing.T, db *bun.DB) {
 
 	group, err := m.Migrate(ctx)
 	require.Error(t, err)
-	require.Equal(t, "failed", err.Error())
+	require.Equal(t, "failed", errors.Unwrap(err).Error())
+
+	var migrationErr *migrate.MigrationError
+	require.True(t, errors.As(err, &migrationErr))
+	require.Equal(t, "20060102160405", migrationErr.Name)
+	require.Equal(t, migrate.DirectionUp, migrationErr.Direction)
+	require.Equal(t, int64(1), migrationErr.GroupID)
 	require.Equal(t, int64(1), group.ID)
 	require.Len(t, group.Migrations, 2)
 	require.Equal(t, []string{"up1", "up2"}, history)
@@ -134,3 +178,1341 @@ func testMigrateUpError(t *testing.T, db *bun.DB) {
 	require.Len(t, group.Migrations, 2)
 	require.Equal(t, []string{"down2", "down1"}, history)
 }
+
+func testMigrateEmpty(t *testing.T, db *bun.DB) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	m := migrate.NewMigrator(db, migrate.NewMigrations(migrate.WithMigrationsDirectory(dir)))
+
+	files, err := m.CreateEmpty(ctx, "deploy_marker")
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	for _, f := range files {
+		require.Empty(t, f.Content)
+	}
+
+	migrations := migrate.NewMigrations()
+	err = migrations.Discover(os.DirFS(dir))
+	require.NoError(t, err)
+
+	m = migrate.NewMigrator(db, migrations)
+	err = m.Reset(ctx)
+	require.NoError(t, err)
+
+	group, err := m.Migrate(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), group.ID)
+	require.Len(t, group.Migrations, 1)
+	require.Equal(t, "deploy_marker", group.Migrations[0].Comment)
+
+	applied, err := m.AppliedMigrations(ctx)
+	require.NoError(t, err)
+	require.Len(t, applied, 1)
+}
+
+func testMigrateTableComment(t *testing.T, db *bun.DB) {
+	var query string
+	switch db.Dialect().Name() {
+	case dialect.PG:
+		query = "SELECT obj_description(?::regclass, 'pg_class')"
+	case dialect.MySQL:
+		query = "SELECT table_comment FROM information_schema.tables " +
+			"WHERE table_schema = DATABASE() AND table_name = ?"
+	default:
+		t.Skip("table comments are not supported")
+	}
+
+	ctx := context.Background()
+
+	tableComment := func() string {
+		var comment string
+		err := db.NewRaw(query, "bun_migrations").Scan(ctx, &comment)
+		require.NoError(t, err)
+		return comment
+	}
+
+	m := migrate.NewMigrator(db, migrate.NewMigrations(),
+		migrate.WithTableComment("managed by bun migrate"))
+	err := m.Reset(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "managed by bun migrate", tableComment())
+
+	m = migrate.NewMigrator(db, migrate.NewMigrations(),
+		migrate.WithTableComment("managed by bun migrate - do not edit"))
+	err = m.Init(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "managed by bun migrate - do not edit", tableComment())
+}
+
+func testMigrateDryRun(t *testing.T, db *bun.DB) {
+	ctx := context.Background()
+
+	var history []string
+
+	migrations := migrate.NewMigrations()
+	err := migrations.Discover(fstest.MapFS{
+		"20060102150405_create.up.sql": {
+			Data: []byte("SELECT 1\n--bun:split\nSELECT 2\n"),
+		},
+	})
+	require.NoError(t, err)
+	migrations.Add(migrate.Migration{
+		Name: "20060102160405",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			history = append(history, "up2")
+			return nil
+		},
+	})
+
+	m := migrate.NewMigrator(db, migrations)
+	err = m.Reset(ctx)
+	require.NoError(t, err)
+
+	group, err := m.Migrate(ctx, migrate.WithDryRun())
+	require.NoError(t, err)
+	require.Equal(t, int64(1), group.ID)
+	require.Len(t, group.Migrations, 2)
+	require.Equal(t, []string{"SELECT 1\n", "SELECT 2\n"}, group.Migrations[0].SQL)
+	require.Nil(t, group.Migrations[1].SQL)
+	require.Nil(t, history)
+
+	applied, err := m.AppliedMigrations(ctx)
+	require.NoError(t, err)
+	require.Len(t, applied, 0)
+}
+
+func testMigrateAuthor(t *testing.T, db *bun.DB) {
+	ctx := context.Background()
+
+	// The migrations table as it was created before the author column was added.
+	type migration struct {
+		ID         int64 `bun:",pk,autoincrement"`
+		Name       string
+		GroupID    int64
+		MigratedAt time.Time `bun:",notnull,nullzero,default:current_timestamp"`
+	}
+
+	_, err := db.NewDropTable().
+		Model((*migration)(nil)).
+		ModelTableExpr("bun_migrations").
+		IfExists().
+		Exec(ctx)
+	require.NoError(t, err)
+	_, err = db.NewCreateTable().
+		Model((*migration)(nil)).
+		ModelTableExpr("bun_migrations").
+		Exec(ctx)
+	require.NoError(t, err)
+
+	migrations := migrate.NewMigrations()
+	migrations.Add(migrate.Migration{
+		Name:   "20060102150405",
+		Author: "dba@example.com",
+	})
+
+	m := migrate.NewMigrator(db, migrations)
+	err = m.Init(ctx)
+	require.NoError(t, err)
+	err = m.Init(ctx)
+	require.NoError(t, err)
+
+	_, err = m.Migrate(ctx)
+	require.NoError(t, err)
+
+	applied, err := m.AppliedMigrations(ctx)
+	require.NoError(t, err)
+	require.Len(t, applied, 1)
+	require.Equal(t, "dba@example.com", applied[0].Author)
+
+	ms, err := m.MigrationsWithStatus(ctx)
+	require.NoError(t, err)
+	require.Len(t, ms, 1)
+	require.Equal(t, "dba@example.com", ms[0].Author)
+}
+
+func testMigrateUpgradeTable(t *testing.T, db *bun.DB) {
+	ctx := context.Background()
+
+	// The migrations table as it was created by older versions.
+	type migration struct {
+		ID         int64 `bun:",pk,autoincrement"`
+		Name       string
+		GroupID    int64
+		MigratedAt time.Time `bun:",notnull,nullzero,default:current_timestamp"`
+	}
+
+	_, err := db.NewDropTable().
+		Model((*migration)(nil)).
+		ModelTableExpr("bun_migrations").
+		IfExists().
+		Exec(ctx)
+	require.NoError(t, err)
+	_, err = db.NewCreateTable().
+		Model((*migration)(nil)).
+		ModelTableExpr("bun_migrations").
+		Exec(ctx)
+	require.NoError(t, err)
+
+	migrations := migrate.NewMigrations()
+	migrations.Add(migrate.Migration{
+		Name:   "20060102150405",
+		Author: "dba@example.com",
+	})
+
+	// Init is not called again after upgrading.
+	m := migrate.NewMigrator(db, migrations)
+	_, err = m.Migrate(ctx)
+	require.NoError(t, err)
+
+	applied, err := m.AppliedMigrations(ctx)
+	require.NoError(t, err)
+	require.Len(t, applied, 1)
+	require.Equal(t, "dba@example.com", applied[0].Author)
+}
+
+func testMigrateDependsOn(t *testing.T, db *bun.DB) {
+	ctx := context.Background()
+
+	var history []string
+
+	migrations := migrate.NewMigrations()
+	migrations.Add(migrate.Migration{
+		Name:      "20060102150405",
+		DependsOn: []string{"20060102160405"},
+		Up: func(ctx context.Context, db *bun.DB) error {
+			history = append(history, "up1")
+			return nil
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			history = append(history, "down1")
+			return nil
+		},
+	})
+	migrations.Add(migrate.Migration{
+		Name: "20060102160405",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			history = append(history, "up2")
+			return nil
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			history = append(history, "down2")
+			return nil
+		},
+	})
+
+	m := migrate.NewMigrator(db, migrations)
+	err := m.Reset(ctx)
+	require.NoError(t, err)
+
+	group, err := m.Migrate(ctx)
+	require.NoError(t, err)
+	require.Len(t, group.Migrations, 2)
+	require.Equal(t, []string{"up2", "up1"}, history)
+
+	history = nil
+	_, err = m.Rollback(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"down1", "down2"}, history)
+}
+
+func testMigrateSkip(t *testing.T, db *bun.DB) {
+	ctx := context.Background()
+
+	var history []string
+
+	migrations := migrate.NewMigrations()
+	migrations.Add(migrate.Migration{
+		Name: "20060102150405",
+		Skip: func(ctx context.Context, db *bun.DB) (bool, error) {
+			history = append(history, "skip1")
+			return true, nil
+		},
+		Up: func(ctx context.Context, db *bun.DB) error {
+			history = append(history, "up1")
+			return nil
+		},
+	})
+	migrations.Add(migrate.Migration{
+		Name: "20060102160405",
+		Skip: func(ctx context.Context, db *bun.DB) (bool, error) {
+			history = append(history, "skip2")
+			return false, nil
+		},
+		Up: func(ctx context.Context, db *bun.DB) error {
+			history = append(history, "up2")
+			return nil
+		},
+	})
+
+	m := migrate.NewMigrator(db, migrations)
+	err := m.Reset(ctx)
+	require.NoError(t, err)
+
+	group, err := m.Migrate(ctx)
+	require.NoError(t, err)
+	require.Len(t, group.Migrations, 2)
+	require.Equal(t, []string{"skip1", "skip2", "up2"}, history)
+
+	applied, err := m.AppliedMigrations(ctx)
+	require.NoError(t, err)
+	require.Len(t, applied, 2)
+}
+
+func testRollbackTo(t *testing.T, db *bun.DB) {
+	ctx := context.Background()
+
+	var history []string
+
+	migrations := migrate.NewMigrations()
+	m := migrate.NewMigrator(db, migrations)
+	err := m.Reset(ctx)
+	require.NoError(t, err)
+
+	for _, name := range []string{"1", "2", "3"} {
+		name := name
+		migrations.Add(migrate.Migration{
+			Name: "2006010215040" + name,
+			Up: func(ctx context.Context, db *bun.DB) error {
+				history = append(history, "up"+name)
+				return nil
+			},
+			Down: func(ctx context.Context, db *bun.DB) error {
+				history = append(history, "down"+name)
+				return nil
+			},
+		})
+
+		m = migrate.NewMigrator(db, migrations)
+		_, err := m.Migrate(ctx)
+		require.NoError(t, err)
+	}
+	require.Equal(t, []string{"up1", "up2", "up3"}, history)
+
+	_, err = m.RollbackTo(ctx, "20060102150409")
+	require.Error(t, err)
+
+	history = nil
+	groups, err := m.RollbackTo(ctx, "20060102150401")
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	require.Equal(t, int64(3), groups[0].ID)
+	require.Equal(t, int64(2), groups[1].ID)
+	require.Equal(t, []string{"down3", "down2"}, history)
+
+	applied, err := m.AppliedMigrations(ctx)
+	require.NoError(t, err)
+	require.Len(t, applied, 1)
+	require.Equal(t, "20060102150401", applied[0].Name)
+}
+
+func testMigrateAdvisoryLock(t *testing.T, db *bun.DB) {
+	ctx := context.Background()
+
+	m1 := migrate.NewMigrator(db, migrate.NewMigrations(),
+		migrate.WithLockStrategy(migrate.AdvisoryLock))
+	m2 := migrate.NewMigrator(db, migrate.NewMigrations(),
+		migrate.WithLockStrategy(migrate.AdvisoryLock))
+
+	err := m1.Reset(ctx)
+	require.NoError(t, err)
+
+	err = m1.Lock(ctx)
+	require.NoError(t, err)
+
+	err = m2.Lock(ctx)
+	require.Error(t, err)
+
+	err = m1.Unlock(ctx)
+	require.NoError(t, err)
+
+	err = m2.Lock(ctx)
+	require.NoError(t, err)
+
+	err = m2.Unlock(ctx)
+	require.NoError(t, err)
+}
+
+func testMigrateDataBackup(t *testing.T, db *bun.DB) {
+	type Lookup struct {
+		bun.BaseModel `bun:"table:migrate_lookups"`
+
+		ID   int64 `bun:",pk"`
+		Name string
+	}
+
+	ctx := context.Background()
+
+	err := db.ResetModel(ctx, (*Lookup)(nil))
+	require.NoError(t, err)
+
+	lookups := []Lookup{{ID: 1, Name: "active"}, {ID: 2, Name: "inactive"}}
+	_, err = db.NewInsert().Model(&lookups).Exec(ctx)
+	require.NoError(t, err)
+
+	migrations := migrate.NewMigrations()
+	migrations.Add(migrate.Migration{
+		Name: "20060102150405",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			_, err := db.NewDropTable().Model((*Lookup)(nil)).Exec(ctx)
+			return err
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			_, err := db.NewCreateTable().Model((*Lookup)(nil)).Exec(ctx)
+			return err
+		},
+	}.WithDataBackup("migrate_lookups", "id", "name"))
+
+	m := migrate.NewMigrator(db, migrations)
+	err = m.Reset(ctx)
+	require.NoError(t, err)
+
+	_, err = m.Migrate(ctx)
+	require.NoError(t, err)
+
+	_, err = m.Rollback(ctx)
+	require.NoError(t, err)
+
+	var restored []Lookup
+	err = db.NewSelect().Model(&restored).Order("id").Scan(ctx)
+	require.NoError(t, err)
+	require.Equal(t, lookups, restored)
+}
+
+func testMigrateDataBackupWithoutDown(t *testing.T, db *bun.DB) {
+	type Lookup struct {
+		bun.BaseModel `bun:"table:migrate_lookups"`
+
+		ID   int64 `bun:",pk"`
+		Name string
+	}
+
+	ctx := context.Background()
+
+	err := db.ResetModel(ctx, (*Lookup)(nil))
+	require.NoError(t, err)
+
+	lookups := []Lookup{{ID: 1, Name: "active"}, {ID: 2, Name: "inactive"}}
+	_, err = db.NewInsert().Model(&lookups).Exec(ctx)
+	require.NoError(t, err)
+
+	migrations := migrate.NewMigrations()
+	migrations.Add(migrate.Migration{
+		Name: "20060102150405",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			if _, err := db.NewUpdate().
+				Model((*Lookup)(nil)).
+				Set("name = ?", "disabled").
+				Where("id = ?", 2).
+				Exec(ctx); err != nil {
+				return err
+			}
+			_, err := db.NewDelete().Model((*Lookup)(nil)).Where("id = ?", 1).Exec(ctx)
+			return err
+		},
+	}.WithDataBackup("migrate_lookups", "id", "name"))
+
+	m := migrate.NewMigrator(db, migrations)
+	err = m.Reset(ctx)
+	require.NoError(t, err)
+
+	_, err = m.Migrate(ctx)
+	require.NoError(t, err)
+
+	_, err = m.Rollback(ctx)
+	require.NoError(t, err)
+
+	var restored []Lookup
+	err = db.NewSelect().Model(&restored).Order("id").Scan(ctx)
+	require.NoError(t, err)
+	require.Equal(t, lookups, restored)
+
+	// The backup table is dropped after the rollback.
+	_, err = db.NewSelect().TableExpr("bun_backup_20060102150405_migrate_lookups").Exists(ctx)
+	require.Error(t, err)
+}
+
+func testMigrateStatus(t *testing.T, db *bun.DB) {
+	ctx := context.Background()
+
+	migrations := migrate.NewMigrations()
+	migrations.Add(migrate.Migration{Name: "20060102150405"})
+	migrations.Add(migrate.Migration{Name: "20060102160405"})
+
+	m := migrate.NewMigrator(db, migrations)
+	err := m.Reset(ctx)
+	require.NoError(t, err)
+
+	status, err := m.Status(ctx)
+	require.NoError(t, err)
+	require.Equal(t, migrate.Status{
+		UnappliedCount: 2,
+		Unapplied:      []string{"20060102150405", "20060102160405"},
+	}, status)
+
+	err = m.Lock(ctx)
+	require.NoError(t, err)
+
+	_, err = m.Migrate(ctx)
+	require.NoError(t, err)
+
+	status, err = m.Status(ctx)
+	require.NoError(t, err)
+	require.Equal(t, migrate.Status{
+		LastGroupID: 1,
+		Unapplied:   []string{},
+		Locked:      true,
+	}, status)
+
+	b, err := json.Marshal(status)
+	require.NoError(t, err)
+	require.JSONEq(t,
+		`{"last_group_id":1,"unapplied_count":0,"unapplied":[],"locked":true}`, string(b))
+
+	err = m.Unlock(ctx)
+	require.NoError(t, err)
+
+	status, err = m.Status(ctx)
+	require.NoError(t, err)
+	require.False(t, status.Locked)
+}
+
+func testMigrateHooks(t *testing.T, db *bun.DB) {
+	ctx := context.Background()
+
+	var history []string
+
+	migrations := migrate.NewMigrations()
+	migrations.Add(migrate.Migration{
+		Name: "20060102150405",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			history = append(history, "up1")
+			return nil
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			history = append(history, "down1")
+			return nil
+		},
+	})
+	migrations.Add(migrate.Migration{
+		Name: "20060102160405",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			history = append(history, "up2")
+			return nil
+		},
+	})
+
+	m := migrate.NewMigrator(db, migrations,
+		migrate.WithMigrationHook(func(
+			ctx context.Context, migration migrate.Migration, direction migrate.Direction,
+		) error {
+			if migration.Name == "20060102160405" {
+				return errors.New("aborted")
+			}
+			history = append(history, "before "+direction.String())
+			return nil
+		}),
+		migrate.WithAfterMigrationHook(func(
+			ctx context.Context, migration migrate.Migration, direction migrate.Direction,
+			err error, dur time.Duration,
+		) {
+			require.NoError(t, err)
+			history = append(history, "after "+direction.String())
+		}),
+	)
+	err := m.Reset(ctx)
+	require.NoError(t, err)
+
+	_, err = m.Migrate(ctx)
+	require.EqualError(t, err, "aborted")
+	require.Equal(t, []string{"before up", "up1", "after up"}, history)
+
+	applied, err := m.AppliedMigrations(ctx)
+	require.NoError(t, err)
+	require.Len(t, applied, 1)
+
+	history = nil
+	_, err = m.Rollback(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"before down", "down1", "after down"}, history)
+}
+
+func testMigrateTransactions(t *testing.T, db *bun.DB) {
+	if db.Dialect().Name() == dialect.MySQL {
+		t.Skip("MySQL implicitly commits DDL")
+	}
+
+	ctx := context.Background()
+
+	for _, table := range []string{"migrate_tx", "migrate_tx_go"} {
+		_, err := db.NewDropTable().Table(table).IfExists().Exec(ctx)
+		require.NoError(t, err)
+	}
+
+	migrations := migrate.NewMigrations()
+	migrations.Add(migrate.Migration{
+		Name: "20060102150405",
+		UpTx: func(ctx context.Context, db bun.IDB) error {
+			tx, ok := migrate.TxFromContext(ctx)
+			require.True(t, ok)
+			require.Equal(t, tx, db)
+
+			_, err := db.NewRaw("CREATE TABLE migrate_tx_go (id int)").Exec(ctx)
+			return err
+		},
+	})
+	err := migrations.Discover(fstest.MapFS{
+		"20060102160405_create.up.sql": {
+			Data: []byte("CREATE TABLE migrate_tx (id int)\n--bun:split\nSELECT * FROM migrate_tx_missing\n"),
+		},
+	})
+	require.NoError(t, err)
+
+	m := migrate.NewMigrator(db, migrations, migrate.WithTransactions(true))
+	err = m.Reset(ctx)
+	require.NoError(t, err)
+
+	_, err = m.Migrate(ctx)
+	require.Error(t, err)
+
+	applied, err := m.AppliedMigrations(ctx)
+	require.NoError(t, err)
+	require.Len(t, applied, 1)
+	require.Equal(t, "20060102150405", applied[0].Name)
+
+	_, err = db.NewRaw("SELECT * FROM migrate_tx").Exec(ctx)
+	require.Error(t, err)
+
+	_, err = db.NewRaw("SELECT * FROM migrate_tx_go").Exec(ctx)
+	require.NoError(t, err)
+}
+
+func testMigrateTransactionsGo(t *testing.T, db *bun.DB) {
+	if db.Dialect().Name() == dialect.MySQL {
+		t.Skip("MySQL implicitly commits DDL")
+	}
+
+	ctx := context.Background()
+
+	_, err := db.NewDropTable().Table("migrate_tx_go").IfExists().Exec(ctx)
+	require.NoError(t, err)
+	_, err = db.NewRaw("CREATE TABLE migrate_tx_go (id int)").Exec(ctx)
+	require.NoError(t, err)
+
+	migrations := migrate.NewMigrations()
+	migrations.Add(migrate.Migration{
+		Name: "20060102150405",
+		// Up gets *bun.DB, so it runs outside of the transaction.
+		Up: func(ctx context.Context, db *bun.DB) error {
+			_, ok := migrate.TxFromContext(ctx)
+			require.False(t, ok)
+
+			_, err := db.NewRaw("INSERT INTO migrate_tx_go (id) VALUES (1)").Exec(ctx)
+			return err
+		},
+	})
+	migrations.Add(migrate.Migration{
+		Name: "20060102160405",
+		UpTx: func(ctx context.Context, db bun.IDB) error {
+			if _, err := db.NewRaw("INSERT INTO migrate_tx_go (id) VALUES (2)").Exec(ctx); err != nil {
+				return err
+			}
+			return errors.New("failed")
+		},
+	})
+
+	m := migrate.NewMigrator(db, migrations, migrate.WithTransactions(true))
+	err = m.Reset(ctx)
+	require.NoError(t, err)
+
+	_, err = m.Migrate(ctx)
+	require.Error(t, err)
+
+	applied, err := m.AppliedMigrations(ctx)
+	require.NoError(t, err)
+	require.Len(t, applied, 1)
+	require.Equal(t, "20060102150405", applied[0].Name)
+
+	var ids []int
+	err = db.NewSelect().TableExpr("migrate_tx_go").Column("id").Scan(ctx, &ids)
+	require.NoError(t, err)
+	require.Equal(t, []int{1}, ids)
+}
+
+func testMigrateSquash(t *testing.T, db *bun.DB) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"20060102150405_first.up.sql":    "SELECT 1\n",
+		"20060102150405_first.down.sql":  "SELECT -1\n",
+		"20060102160405_second.up.sql":   "SELECT 2\n",
+		"20060102160405_second.down.sql": "SELECT -2\n",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)
+		require.NoError(t, err)
+	}
+
+	migrations := migrate.NewMigrations(migrate.WithMigrationsDirectory(dir))
+	err := migrations.Discover(os.DirFS(dir))
+	require.NoError(t, err)
+	migrations.Add(migrate.Migration{Name: "20060102170405"})
+
+	m := migrate.NewMigrator(db, migrations)
+	err = m.Reset(ctx)
+	require.NoError(t, err)
+
+	squashed, err := m.Squash(ctx, "20060102160405", migrate.WithDeleteOriginals(true))
+	require.NoError(t, err)
+	require.Equal(t, "20060102160405", squashed.Name)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	up, err := os.ReadFile(filepath.Join(dir, "20060102160405_squashed.up.sql"))
+	require.NoError(t, err)
+	require.Equal(t, "-- 20060102150405_first\nSELECT 1\n--bun:split\n"+
+		"-- 20060102160405_second\nSELECT 2\n", string(up))
+
+	down, err := os.ReadFile(filepath.Join(dir, "20060102160405_squashed.down.sql"))
+	require.NoError(t, err)
+	require.Equal(t, "-- 20060102160405_second\nSELECT -2\n--bun:split\n"+
+		"-- 20060102150405_first\nSELECT -1\n", string(down))
+
+	group, err := m.Migrate(ctx)
+	require.NoError(t, err)
+	require.Len(t, group.Migrations, 2)
+	require.Equal(t, "20060102160405", group.Migrations[0].Name)
+}
+
+func testMigrateSquashApplied(t *testing.T, db *bun.DB) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	writeFiles := func(files map[string]string) {
+		for name, content := range files {
+			err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)
+			require.NoError(t, err)
+		}
+	}
+	newMigrator := func() *migrate.Migrator {
+		migrations := migrate.NewMigrations(migrate.WithMigrationsDirectory(dir))
+		err := migrations.Discover(os.DirFS(dir))
+		require.NoError(t, err)
+		return migrate.NewMigrator(db, migrations)
+	}
+
+	// Apply the migrations in separate groups.
+	writeFiles(map[string]string{
+		"20060102150405_first.up.sql":   "SELECT 1\n",
+		"20060102150405_first.down.sql": "SELECT -1\n",
+	})
+	m := newMigrator()
+	err := m.Reset(ctx)
+	require.NoError(t, err)
+	_, err = m.Migrate(ctx)
+	require.NoError(t, err)
+
+	writeFiles(map[string]string{
+		"20060102160405_second.up.sql":   "SELECT 2\n",
+		"20060102160405_second.down.sql": "SELECT -2\n",
+	})
+	m = newMigrator()
+	_, err = m.Migrate(ctx)
+	require.NoError(t, err)
+
+	squashed, err := m.Squash(ctx, "20060102160405", migrate.WithDeleteOriginals(true))
+	require.NoError(t, err)
+	require.True(t, squashed.IsApplied())
+	require.Equal(t, int64(2), squashed.GroupID)
+
+	applied, err := m.AppliedMigrations(ctx)
+	require.NoError(t, err)
+	require.Len(t, applied, 1)
+	require.Equal(t, "20060102160405", applied[0].Name)
+	require.Equal(t, int64(2), applied[0].GroupID)
+
+	missing, err := m.MissingMigrations(ctx)
+	require.NoError(t, err)
+	require.Empty(t, missing)
+
+	group, err := m.Rollback(ctx)
+	require.NoError(t, err)
+	require.Len(t, group.Migrations, 1)
+
+	applied, err = m.AppliedMigrations(ctx)
+	require.NoError(t, err)
+	require.Empty(t, applied)
+}
+
+func testMigrateSquashKeepOriginals(t *testing.T, db *bun.DB) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"20060102150405_first.up.sql":  "SELECT 1\n",
+		"20060102160405_second.up.sql": "SELECT 2\n",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)
+		require.NoError(t, err)
+	}
+
+	migrations := migrate.NewMigrations(migrate.WithMigrationsDirectory(dir))
+	err := migrations.Discover(os.DirFS(dir))
+	require.NoError(t, err)
+
+	m := migrate.NewMigrator(db, migrations)
+	err = m.Reset(ctx)
+	require.NoError(t, err)
+
+	_, err = m.Squash(ctx, "20060102160405")
+	require.NoError(t, err)
+
+	for name := range files {
+		_, err := os.Stat(filepath.Join(dir, name+".orig"))
+		require.NoError(t, err)
+	}
+
+	// Discovering the directory again only finds the squashed migration.
+	rediscovered := migrate.NewMigrations()
+	err = rediscovered.Discover(os.DirFS(dir))
+	require.NoError(t, err)
+
+	ms := rediscovered.Sorted()
+	require.Len(t, ms, 1)
+	require.Equal(t, "20060102160405", ms[0].Name)
+	require.Equal(t, "squashed", ms[0].Comment)
+}
+
+func testMigrateSquashOtherFS(t *testing.T, db *bun.DB) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	migrations := migrate.NewMigrations(migrate.WithMigrationsDirectory(dir))
+	err := migrations.Discover(fstest.MapFS{
+		"20060102150405_first.up.sql":  {Data: []byte("SELECT 1\n")},
+		"20060102160405_second.up.sql": {Data: []byte("SELECT 2\n")},
+	})
+	require.NoError(t, err)
+
+	m := migrate.NewMigrator(db, migrations)
+	err = m.Reset(ctx)
+	require.NoError(t, err)
+
+	_, err = m.Squash(ctx, "20060102160405")
+	require.Error(t, err)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 0)
+}
+
+func testMigrateSquashTx(t *testing.T, db *bun.DB) {
+	ctx := context.Background()
+
+	squash := func(files map[string]string) (string, error) {
+		dir := t.TempDir()
+		for name, content := range files {
+			err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)
+			require.NoError(t, err)
+		}
+
+		migrations := migrate.NewMigrations(migrate.WithMigrationsDirectory(dir))
+		err := migrations.Discover(os.DirFS(dir))
+		require.NoError(t, err)
+
+		m := migrate.NewMigrator(db, migrations)
+		err = m.Reset(ctx)
+		require.NoError(t, err)
+
+		_, err = m.Squash(ctx, "20060102160405", migrate.WithDeleteOriginals(true))
+		return dir, err
+	}
+
+	dir, err := squash(map[string]string{
+		"20060102150405_first.tx.up.sql":  "SELECT 1\n",
+		"20060102160405_second.tx.up.sql": "SELECT 2\n",
+	})
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "20060102160405_squashed.tx.up.sql", entries[0].Name())
+
+	// Squashing would drop the transaction of the first migration.
+	dir, err = squash(map[string]string{
+		"20060102150405_first.tx.up.sql": "SELECT 1\n",
+		"20060102160405_second.up.sql":   "SELECT 2\n",
+	})
+	require.Error(t, err)
+
+	entries, err = os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+}
+
+func testMigrateDuration(t *testing.T, db *bun.DB) {
+	ctx := context.Background()
+
+	for _, onSuccess := range []bool{false, true} {
+		migrations := migrate.NewMigrations()
+		migrations.Add(migrate.Migration{
+			Name: "20060102150405",
+			Up: func(ctx context.Context, db *bun.DB) error {
+				time.Sleep(10 * time.Millisecond)
+				return nil
+			},
+		})
+
+		m := migrate.NewMigrator(db, migrations, migrate.WithMarkAppliedOnSuccess(onSuccess))
+		err := m.Reset(ctx)
+		require.NoError(t, err)
+
+		group, err := m.Migrate(ctx)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, group.Migrations[0].DurationMS, int64(10))
+
+		applied, err := m.AppliedMigrations(ctx)
+		require.NoError(t, err)
+		require.Len(t, applied, 1)
+		require.GreaterOrEqual(t, applied[0].DurationMS, int64(10))
+		require.False(t, applied[0].MigratedAt.IsZero())
+	}
+}
+
+func testMigrateBaseline(t *testing.T, db *bun.DB) {
+	ctx := context.Background()
+
+	var history []string
+
+	migrations := migrate.NewMigrations()
+	for _, name := range []string{"1", "2", "3"} {
+		name := name
+		migrations.Add(migrate.Migration{
+			Name: "2006010215040" + name,
+			Up: func(ctx context.Context, db *bun.DB) error {
+				history = append(history, "up"+name)
+				return nil
+			},
+		})
+	}
+
+	m := migrate.NewMigrator(db, migrations)
+	err := m.Reset(ctx)
+	require.NoError(t, err)
+
+	_, err = m.Baseline(ctx, "20060102150409")
+	require.Error(t, err)
+
+	group, err := m.Baseline(ctx, "20060102150402")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), group.ID)
+	require.Len(t, group.Migrations, 2)
+	require.Nil(t, history)
+
+	group, err = m.Migrate(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), group.ID)
+	require.Len(t, group.Migrations, 1)
+	require.Equal(t, []string{"up3"}, history)
+}
+
+func testMigrateLockTimeout(t *testing.T, db *bun.DB) {
+	ctx := context.Background()
+
+	m1 := migrate.NewMigrator(db, migrate.NewMigrations())
+	m2 := migrate.NewMigrator(db, migrate.NewMigrations(),
+		migrate.WithLockTimeout(200*time.Millisecond),
+		migrate.WithLockRetryInterval(10*time.Millisecond))
+
+	err := m1.Reset(ctx)
+	require.NoError(t, err)
+
+	err = m1.Lock(ctx)
+	require.NoError(t, err)
+
+	err = m2.Lock(ctx)
+	require.ErrorIs(t, err, migrate.ErrLockTimeout)
+
+	unlocked := make(chan error, 1)
+	time.AfterFunc(50*time.Millisecond, func() {
+		unlocked <- m1.Unlock(ctx)
+	})
+
+	err = m2.Lock(ctx)
+	require.NoError(t, err)
+	require.NoError(t, <-unlocked)
+
+	err = m2.Unlock(ctx)
+	require.NoError(t, err)
+}
+
+func testMigrateComment(t *testing.T, db *bun.DB) {
+	ctx := context.Background()
+
+	migrations := migrate.NewMigrations()
+	err := migrations.Discover(fstest.MapFS{
+		"20060102150405_users.up.sql": {
+			Data: []byte("--bun:comment add users email index\nSELECT 1\n"),
+		},
+		"20060102160405_orders.up.sql": {Data: []byte("SELECT 2\n")},
+	})
+	require.NoError(t, err)
+
+	m := migrate.NewMigrator(db, migrations)
+	err = m.Reset(ctx)
+	require.NoError(t, err)
+
+	_, err = m.Migrate(ctx)
+	require.NoError(t, err)
+
+	applied, err := m.AppliedMigrations(ctx)
+	require.NoError(t, err)
+	require.Len(t, applied, 2)
+
+	descriptions := make(map[string]string)
+	for _, migration := range applied {
+		descriptions[migration.Name] = migration.Description
+	}
+	require.Equal(t, map[string]string{
+		"20060102150405": "add users email index",
+		"20060102160405": "",
+	}, descriptions)
+
+	ms, err := m.MigrationsWithStatus(ctx)
+	require.NoError(t, err)
+	require.Len(t, ms, 2)
+	require.Equal(t, "20060102150405_users", ms[0].String())
+	require.Equal(t, "add users email index", ms[0].Description)
+}
+
+func testMigrateOne(t *testing.T, db *bun.DB) {
+	ctx := context.Background()
+
+	var history []string
+
+	migrations := migrate.NewMigrations()
+	for i, name := range []string{"20060102150405", "20060102160405", "20060102170405"} {
+		n := strconv.Itoa(i + 1)
+		migration := migrate.Migration{
+			Name: name,
+			Up: func(ctx context.Context, db *bun.DB) error {
+				history = append(history, "up"+n)
+				return nil
+			},
+			Down: func(ctx context.Context, db *bun.DB) error {
+				history = append(history, "down"+n)
+				return nil
+			},
+		}
+		if i == 2 {
+			migration.DependsOn = []string{"20060102150405"}
+		}
+		migrations.Add(migration)
+	}
+
+	m := migrate.NewMigrator(db, migrations)
+	err := m.Reset(ctx)
+	require.NoError(t, err)
+
+	_, err = m.MigrateOne(ctx, "20060102170405")
+	require.Error(t, err)
+
+	group, err := m.MigrateOne(ctx, "20060102160405")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), group.ID)
+	require.Len(t, group.Migrations, 1)
+	require.Equal(t, []string{"up2"}, history)
+
+	_, err = m.MigrateOne(ctx, "20060102160405")
+	require.Error(t, err)
+
+	group, err = m.Migrate(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), group.ID)
+	require.Equal(t, []string{"up2", "up1", "up3"}, history)
+
+	_, err = m.RollbackOne(ctx, "20060102150405")
+	require.Error(t, err)
+
+	history = nil
+	group, err = m.RollbackOne(ctx, "20060102160405")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), group.ID)
+	require.Equal(t, []string{"down2"}, history)
+
+	ms, err := m.MigrationsWithStatus(ctx)
+	require.NoError(t, err)
+	unapplied := ms.Unapplied()
+	require.Len(t, unapplied, 1)
+	require.Equal(t, "20060102160405", unapplied[0].Name)
+}
+
+func testMigrateTableSchema(t *testing.T, db *bun.DB) {
+	if db.Dialect().Name() != dialect.PG {
+		t.Skip("table schemas are only tested on PostgreSQL")
+	}
+
+	ctx := context.Background()
+
+	_, err := db.ExecContext(ctx, "CREATE SCHEMA IF NOT EXISTS migrations")
+	require.NoError(t, err)
+
+	migrations := migrate.NewMigrations()
+	migrations.Add(migrate.Migration{
+		Name: "20060102150405",
+		Up:   func(ctx context.Context, db *bun.DB) error { return nil },
+	})
+
+	m := migrate.NewMigrator(db, migrations, migrate.WithTableSchema("migrations"))
+	err = m.Reset(ctx)
+	require.NoError(t, err)
+
+	err = m.Lock(ctx)
+	require.NoError(t, err)
+
+	_, err = m.Migrate(ctx)
+	require.NoError(t, err)
+
+	err = m.Unlock(ctx)
+	require.NoError(t, err)
+
+	count, err := db.NewSelect().TableExpr("migrations.bun_migrations").Count(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+}
+
+func testMigrateLockCallbacks(t *testing.T, db *bun.DB) {
+	ctx := context.Background()
+
+	for _, strategy := range []migrate.LockStrategy{migrate.TableLock, migrate.AdvisoryLock} {
+		var events []string
+
+		m := migrate.NewMigrator(db, migrate.NewMigrations(),
+			migrate.WithLockStrategy(strategy),
+			migrate.WithOnLock(func() { events = append(events, "lock") }),
+			migrate.WithOnUnlock(func() { events = append(events, "unlock") }))
+		other := migrate.NewMigrator(db, migrate.NewMigrations(),
+			migrate.WithLockStrategy(strategy))
+
+		err := m.Reset(ctx)
+		require.NoError(t, err)
+
+		err = m.Lock(ctx)
+		require.NoError(t, err)
+
+		err = other.Lock(ctx)
+		require.Error(t, err)
+
+		err = m.Unlock(ctx)
+		require.NoError(t, err)
+
+		require.Equal(t, []string{"lock", "unlock"}, events)
+	}
+}
+
+func testMigrateSeed(t *testing.T, db *bun.DB) {
+	if db.Dialect().Name() == dialect.MSSQL {
+		t.Skip("Seed is not supported on MSSQL")
+	}
+
+	type Status struct {
+		bun.BaseModel `bun:"table:migrate_seed_statuses"`
+
+		ID   int64 `bun:",pk"`
+		Name string
+	}
+
+	type Country struct {
+		bun.BaseModel `bun:"table:migrate_seed_countries"`
+
+		Code string `bun:",unique"`
+		Name string
+	}
+
+	ctx := context.Background()
+
+	err := db.ResetModel(ctx, (*Status)(nil), (*Country)(nil))
+	require.NoError(t, err)
+
+	err = migrate.Seed(ctx, db, &[]Status{{ID: 1, Name: "active"}, {ID: 2, Name: "inactive"}})
+	require.NoError(t, err)
+	err = migrate.Seed(ctx, db, &[]Status{{ID: 2, Name: "disabled"}, {ID: 3, Name: "deleted"}})
+	require.NoError(t, err)
+
+	var statuses []Status
+	err = db.NewSelect().Model(&statuses).Order("id").Scan(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []Status{
+		{ID: 1, Name: "active"},
+		{ID: 2, Name: "disabled"},
+		{ID: 3, Name: "deleted"},
+	}, statuses)
+
+	err = migrate.Seed(ctx, db, &[]Country{{Code: "de", Name: "Germany"}})
+	require.NoError(t, err)
+	err = migrate.Seed(ctx, db, &[]Country{{Code: "de", Name: "Deutschland"}})
+	require.NoError(t, err)
+
+	var countries []Country
+	err = db.NewSelect().Model(&countries).Scan(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []Country{{Code: "de", Name: "Deutschland"}}, countries)
+
+	err = migrate.Seed(ctx, db, "not a model")
+	require.Error(t, err)
+}
+
+func testMigrateSteps(t *testing.T, db *bun.DB) {
+	ctx := context.Background()
+
+	var history []string
+
+	migrations := migrate.NewMigrations()
+	for i, name := range []string{"20060102150405", "20060102160405", "20060102170405"} {
+		n := strconv.Itoa(i + 1)
+		migrations.Add(migrate.Migration{
+			Name: name,
+			Up: func(ctx context.Context, db *bun.DB) error {
+				history = append(history, "up"+n)
+				return nil
+			},
+			Down: func(ctx context.Context, db *bun.DB) error {
+				history = append(history, "down"+n)
+				return nil
+			},
+		})
+	}
+
+	m := migrate.NewMigrator(db, migrations)
+	err := m.Reset(ctx)
+	require.NoError(t, err)
+
+	group, err := m.Migrate(ctx, migrate.WithSteps(2))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), group.ID)
+	require.Len(t, group.Migrations, 2)
+	require.Equal(t, []string{"up1", "up2"}, history)
+
+	history = nil
+	group, err = m.Rollback(ctx, migrate.WithSteps(1))
+	require.NoError(t, err)
+	require.Len(t, group.Migrations, 1)
+	require.Equal(t, "20060102160405", group.Migrations[0].Name)
+	require.Equal(t, []string{"down2"}, history)
+
+	history = nil
+	group, err = m.Migrate(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), group.ID)
+	require.Equal(t, []string{"up2", "up3"}, history)
+}
+
+func testMigratePrePostHooks(t *testing.T, db *bun.DB) {
+	ctx := context.Background()
+
+	var history []string
+
+	migrations := migrate.NewMigrations()
+	for i, name := range []string{"20060102150405", "20060102160405", "20060102170405"} {
+		up := "up" + strconv.Itoa(i+1)
+		migrations.Add(migrate.Migration{
+			Name: name,
+			Up: func(ctx context.Context, db *bun.DB) error {
+				history = append(history, up)
+				return nil
+			},
+		})
+	}
+
+	var preErr error
+	m := migrate.NewMigrator(db, migrations,
+		migrate.WithPreMigrateHook(func(ctx context.Context) error {
+			history = append(history, "pre")
+			return preErr
+		}),
+		migrate.WithPostMigrateHook(func(
+			ctx context.Context, group *migrate.MigrationGroup, err error,
+		) {
+			require.NoError(t, err)
+			history = append(history, "post "+strconv.Itoa(len(group.Migrations)))
+		}),
+		migrate.WithOnLock(func() {
+			history = append(history, "lock")
+		}),
+		migrate.WithOnUnlock(func() {
+			history = append(history, "unlock")
+		}),
+	)
+	err := m.Reset(ctx)
+	require.NoError(t, err)
+
+	// The failing hook aborts before acquiring the lock.
+	preErr = errors.New("replicas are not ready")
+	_, err = m.Migrate(ctx, migrate.WithLock())
+	require.Equal(t, preErr, err)
+	require.Equal(t, []string{"pre"}, history)
+
+	history = nil
+	preErr = nil
+	_, err = m.MigrateOne(ctx, "20060102150405")
+	require.NoError(t, err)
+	require.Equal(t, []string{"pre", "up1", "post 1"}, history)
+
+	history = nil
+	_, err = m.Migrate(ctx, migrate.WithSteps(1), migrate.WithLock())
+	require.NoError(t, err)
+	require.Equal(t, []string{"pre", "lock", "up2", "unlock", "post 1"}, history)
+
+	history = nil
+	_, err = m.Baseline(ctx, "20060102170405")
+	require.NoError(t, err)
+	require.Equal(t, []string{"pre", "post 1"}, history)
+
+	history = nil
+	_, err = m.Migrate(ctx)
+	require.NoError(t, err)
+	require.Empty(t, history)
+}
+
+func testMigrateDisableTransaction(t *testing.T, db *bun.DB) {
+	if db.Dialect().Name() == dialect.MySQL {
+		t.Skip("MySQL does not use transactions for migrations")
+	}
+
+	ctx := context.Background()
+
+	inTx := make(map[string]bool)
+	up := func(ctx context.Context, db bun.IDB) error {
+		_, ok := migrate.TxFromContext(ctx)
+		inTx[strconv.Itoa(len(inTx)+1)] = ok
+		return nil
+	}
+
+	migrations := migrate.NewMigrations()
+	migrations.Add(migrate.Migration{
+		Name: "20060102150405",
+		UpTx: up,
+	})
+	migrations.Add(migrate.Migration{
+		Name:               "20060102160405",
+		UpTx:               up,
+		DisableTransaction: true,
+	})
+
+	m := migrate.NewMigrator(db, migrations, migrate.WithTransactions(true))
+	err := m.Reset(ctx)
+	require.NoError(t, err)
+
+	_, err = m.Migrate(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"1": true, "2": false}, inTx)
+
+	applied, err := m.AppliedMigrations(ctx)
+	require.NoError(t, err)
+	require.Len(t, applied, 2)
+}
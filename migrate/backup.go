@@ -0,0 +1,166 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+)
+
+// DataBackup describes table columns that are copied into a backup table before
+// the migration is applied, so they can be restored when the migration is rolled back.
+// The first column must uniquely identify rows, e.g. the primary key.
+type DataBackup struct {
+	Table   string
+	Columns []string
+}
+
+// WithDataBackup returns a copy of the migration that backs up the columns of the table
+// before Up and restores them after Down. It is best-effort and is meant for small
+// tables, e.g. lookup tables, since all rows are copied.
+//
+// Rows are restored by updating the rows with the same key and inserting the missing ones.
+// The backup table is dropped after a successful rollback or once a newer migration
+// group is applied. Migrations that only change data may omit Down:
+// rolling them back restores the backed up columns.
+func (m Migration) WithDataBackup(table string, columns ...string) Migration {
+	m.Backups = append(m.Backups[:len(m.Backups):len(m.Backups)], DataBackup{
+		Table:   table,
+		Columns: columns,
+	})
+	return m
+}
+
+var backupNameRE = regexp.MustCompile(`[^0-9A-Za-z_]+`)
+
+func (b *DataBackup) tableName(migration *Migration) string {
+	name := "bun_backup_" + migration.Name + "_" + b.Table
+	return strings.ToLower(backupNameRE.ReplaceAllString(name, "_"))
+}
+
+func (m *Migrator) backupData(ctx context.Context, db bun.IDB, migration *Migration) error {
+	for i := range migration.Backups {
+		backup := &migration.Backups[i]
+		if len(backup.Columns) == 0 {
+			return errors.New("migrate: data backup requires at least one column")
+		}
+
+		backupTable := backup.tableName(migration)
+		if err := m.dropBackup(ctx, db, backupTable); err != nil {
+			return err
+		}
+
+		var query string
+		if db.Dialect().Name() == dialect.MSSQL {
+			query = "SELECT ? INTO ? FROM ?"
+		} else {
+			query = "CREATE TABLE ?1 AS SELECT ?0 FROM ?2"
+		}
+		if _, err := db.NewRaw(
+			query, bun.In(identSlice(backup.Columns)), bun.Ident(backupTable), bun.Ident(backup.Table),
+		).Exec(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) restoreData(ctx context.Context, db bun.IDB, migration *Migration) error {
+	for i := range migration.Backups {
+		backup := &migration.Backups[i]
+		backupTable := backup.tableName(migration)
+
+		// The backup is gone when a newer migration group has been applied.
+		exists, err := tableExists(ctx, db, backupTable)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+
+		key := bun.Ident(backup.Columns[0])
+		columns := identSlice(backup.Columns)
+
+		if len(columns) > 1 {
+			q := db.NewUpdate().
+				Table(backup.Table).
+				Where("? IN (SELECT ? FROM ?)", key, key, bun.Ident(backupTable))
+			for _, col := range columns[1:] {
+				q = q.Set("? = (SELECT b.? FROM ? AS b WHERE b.? = ?.?)",
+					col, col, bun.Ident(backupTable), key, bun.Ident(backup.Table), key)
+			}
+			if _, err := q.Exec(ctx); err != nil {
+				return err
+			}
+		}
+
+		if _, err := db.NewRaw(
+			"INSERT INTO ? (?) SELECT ? FROM ? WHERE ? NOT IN (SELECT ? FROM ?)",
+			bun.Ident(backup.Table), bun.In(columns), bun.In(columns), bun.Ident(backupTable),
+			key, key, bun.Ident(backup.Table),
+		).Exec(ctx); err != nil {
+			return err
+		}
+
+		if err := m.dropBackup(ctx, db, backupTable); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropStaleBackups drops backups of the applied migrations.
+func (m *Migrator) dropStaleBackups(ctx context.Context, ms MigrationSlice) error {
+	for i := range ms {
+		migration := &ms[i]
+		if !migration.IsApplied() {
+			continue
+		}
+		for j := range migration.Backups {
+			if err := m.dropBackup(ctx, m.db, migration.Backups[j].tableName(migration)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) dropBackup(ctx context.Context, db bun.IDB, table string) error {
+	_, err := db.NewDropTable().Table(table).IfExists().Exec(ctx)
+	return err
+}
+
+func tableExists(ctx context.Context, db bun.IDB, table string) (bool, error) {
+	q := db.NewSelect()
+	switch db.Dialect().Name() {
+	case dialect.SQLite:
+		q = q.TableExpr("sqlite_master").
+			Where("type = 'table'").
+			Where("name = ?", table)
+	case dialect.MySQL:
+		q = q.TableExpr("information_schema.tables").
+			Where("table_schema = DATABASE()").
+			Where("table_name = ?", table)
+	case dialect.MSSQL:
+		q = q.TableExpr("information_schema.tables").
+			Where("table_schema = SCHEMA_NAME()").
+			Where("table_name = ?", table)
+	default:
+		q = q.TableExpr("information_schema.tables").
+			Where("table_schema = current_schema()").
+			Where("table_name = ?", table)
+	}
+	return q.Exists(ctx)
+}
+
+func identSlice(names []string) []bun.Ident {
+	idents := make([]bun.Ident, len(names))
+	for i, name := range names {
+		idents[i] = bun.Ident(name)
+	}
+	return idents
+}
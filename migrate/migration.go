@@ -22,9 +22,46 @@ type Migration struct {
 	Comment    string `bun:"-"`
 	GroupID    int64
 	MigratedAt time.Time `bun:",notnull,nullzero,default:current_timestamp"`
+	DurationMS int64
+	Author     string
+
+	// Description is a human-readable summary of the migration that is stored
+	// in the migrations table. Discover takes it from a leading "--bun:comment"
+	// line in .up.sql files.
+	Description string
 
 	Up   MigrationFunc `bun:"-"`
 	Down MigrationFunc `bun:"-"`
+
+	// UpTx and DownTx are used instead of Up and Down. They receive the transaction
+	// when WithTransactions is enabled and the database otherwise.
+	UpTx   MigrationTxFunc `bun:"-"`
+	DownTx MigrationTxFunc `bun:"-"`
+
+	// Skip is called before Up. When it returns true, Up is not called
+	// but the migration is still marked as applied.
+	Skip func(ctx context.Context, db *bun.DB) (bool, error) `bun:"-"`
+
+	// Backups contains tables that are backed up before Up and restored after Down.
+	// See WithDataBackup.
+	Backups []DataBackup `bun:"-"`
+
+	// DependsOn contains names of migrations that must be applied before this one.
+	// Migrations without dependencies are applied in the name order.
+	DependsOn []string `bun:"-"`
+
+	// DisableTransaction runs the migration outside of the transaction used by
+	// WithTransactions, for example, for CREATE INDEX CONCURRENTLY. The trade-off is
+	// that a failed migration is not rolled back atomically and may leave
+	// the database and the migrations table partially updated.
+	DisableTransaction bool `bun:"-"`
+
+	// SQL contains the queries that the migration would execute.
+	// It is only set by Migrate with WithDryRun and only for SQL migrations.
+	SQL []string `bun:"-"`
+
+	upFile   *sqlMigrationFile
+	downFile *sqlMigrationFile
 }
 
 func (m Migration) String() string {
@@ -35,8 +72,43 @@ func (m Migration) IsApplied() bool {
 	return m.ID > 0
 }
 
+// hasFunc reports whether the migration has something to run in the direction.
+func (m *Migration) hasFunc(direction Direction) bool {
+	if direction == DirectionDown {
+		return m.Down != nil || m.DownTx != nil
+	}
+	return m.Up != nil || m.UpTx != nil
+}
+
+// canRunInTx reports whether the migration can run in the direction inside
+// the transaction used by WithTransactions. Go migrations that only get *bun.DB
+// can't, because their queries would bypass the transaction.
+func (m *Migration) canRunInTx(direction Direction) bool {
+	if direction == DirectionDown {
+		return m.downFile != nil || m.DownTx != nil || m.Down == nil
+	}
+	return m.upFile != nil || m.UpTx != nil || m.Up == nil
+}
+
 type MigrationFunc func(ctx context.Context, db *bun.DB) error
 
+// MigrationTxFunc is like MigrationFunc, but db is the transaction
+// when the migration runs in one.
+type MigrationTxFunc func(ctx context.Context, db bun.IDB) error
+
+type txKey struct{}
+
+func contextWithTx(ctx context.Context, tx bun.Tx) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+// TxFromContext returns the transaction in which the migrator runs the migration
+// when WithTransactions is enabled.
+func TxFromContext(ctx context.Context) (bun.Tx, bool) {
+	tx, ok := ctx.Value(txKey{}).(bun.Tx)
+	return tx, ok
+}
+
 func NewSQLMigrationFunc(fsys fs.FS, name string) MigrationFunc {
 	return func(ctx context.Context, db *bun.DB) error {
 		f, err := fsys.Open(name)
@@ -44,13 +116,41 @@ func NewSQLMigrationFunc(fsys fs.FS, name string) MigrationFunc {
 			return err
 		}
 
-		isTx := strings.HasSuffix(name, ".tx.up.sql") || strings.HasSuffix(name, ".tx.down.sql")
-		return Exec(ctx, db, f, isTx)
+		return Exec(ctx, db, f, isTxMigrationFile(name))
+	}
+}
+
+func isTxMigrationFile(name string) bool {
+	return strings.HasSuffix(name, ".tx.up.sql") || strings.HasSuffix(name, ".tx.down.sql")
+}
+
+type sqlMigrationFile struct {
+	fsys fs.FS
+	name string
+}
+
+func (f *sqlMigrationFile) queries() ([]string, error) {
+	file, err := f.fsys.Open(f.name)
+	if err != nil {
+		return nil, err
 	}
+	defer file.Close()
+
+	return readQueries(file)
 }
 
 // Exec reads and executes the SQL migration in the f.
 func Exec(ctx context.Context, db *bun.DB, f io.Reader, isTx bool) error {
+	queries, err := readQueries(f)
+	if err != nil {
+		return err
+	}
+
+	return execQueries(ctx, db, queries, isTx)
+}
+
+// readQueries reads the queries from the SQL migration in the f.
+func readQueries(f io.Reader) ([]string, error) {
 	scanner := bufio.NewScanner(f)
 	var queries []string
 
@@ -66,7 +166,11 @@ func Exec(ctx context.Context, db *bun.DB, f io.Reader, isTx bool) error {
 				query = query[:0]
 				continue
 			}
-			return fmt.Errorf("bun: unknown directive: %q", b)
+			// The comment directive is read by Discover.
+			if bytes.Equal(b, []byte("comment")) || bytes.HasPrefix(b, []byte("comment ")) {
+				continue
+			}
+			return nil, fmt.Errorf("bun: unknown directive: %q", b)
 		}
 
 		query = append(query, b...)
@@ -77,7 +181,19 @@ func Exec(ctx context.Context, db *bun.DB, f io.Reader, isTx bool) error {
 		queries = append(queries, string(query))
 	}
 	if err := scanner.Err(); err != nil {
-		return err
+		return nil, err
+	}
+	return queries, nil
+}
+
+func execQueries(ctx context.Context, db *bun.DB, queries []string, isTx bool) error {
+	if tx, ok := TxFromContext(ctx); ok {
+		for _, q := range queries {
+			if _, err := tx.ExecContext(ctx, q); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
 
 	var idb bun.IConn
@@ -216,6 +332,11 @@ func (ms MigrationSlice) LastGroupID() int64 {
 	return lastGroupID
 }
 
+// SortByName sorts migrations by name in ascending order.
+func (ms MigrationSlice) SortByName() {
+	sortAsc(ms)
+}
+
 // LastGroup returns the last applied migration group.
 func (ms MigrationSlice) LastGroup() *MigrationGroup {
 	group := &MigrationGroup{
@@ -229,6 +350,11 @@ func (ms MigrationSlice) LastGroup() *MigrationGroup {
 			group.Migrations = append(group.Migrations, ms[i])
 		}
 	}
+	// Migrations are applied in the id order which may differ from the name order
+	// when migrations have dependencies.
+	sort.SliceStable(group.Migrations, func(i, j int) bool {
+		return group.Migrations[i].ID < group.Migrations[j].ID
+	})
 	return group
 }
 
@@ -245,7 +371,7 @@ func (g MigrationGroup) String() string {
 	if g.IsZero() {
 		return "nil"
 	}
-	return fmt.Sprintf("group #%d (%s)", g.ID, g.Migrations)
+	return fmt.Sprintf("group #%d (migrations: %s)", g.ID, g.Migrations)
 }
 
 type MigrationFile struct {
@@ -257,7 +383,10 @@ type MigrationFile struct {
 //------------------------------------------------------------------------------
 
 type migrationConfig struct {
-	nop bool
+	nop    bool
+	dryRun bool
+	steps  int
+	lock   bool
 }
 
 func newMigrationConfig(opts []MigrationOption) *migrationConfig {
@@ -276,8 +405,119 @@ func WithNopMigration() MigrationOption {
 	}
 }
 
+// WithDryRun makes Migrate return the migrations that would be applied
+// without running them or updating the migrations table.
+// For SQL migrations Migration.SQL is set to the queries that would be executed.
+func WithDryRun() MigrationOption {
+	return func(cfg *migrationConfig) {
+		cfg.dryRun = true
+	}
+}
+
+// WithSteps limits the number of migrations. Migrate applies at most the next n
+// unapplied migrations in one group, and Rollback rolls back at most the n most
+// recently applied migrations of the last group. Zero means no limit.
+func WithSteps(n int) MigrationOption {
+	return func(cfg *migrationConfig) {
+		cfg.steps = n
+	}
+}
+
+// WithLock makes Migrate and MigrateOne acquire the lock (see Migrator.Lock)
+// after the pre-migrate hooks and release it before the post-migrate hooks,
+// so a failing pre-migrate hook aborts without waiting for the lock.
+// Don't use it when the caller already holds the lock.
+func WithLock() MigrationOption {
+	return func(cfg *migrationConfig) {
+		cfg.lock = true
+	}
+}
+
 //------------------------------------------------------------------------------
 
+// sortDeps sorts unapplied migrations so that each migration comes after the migrations
+// it depends on. Independent migrations keep the ascending name order.
+func sortDeps(all, unapplied MigrationSlice) (MigrationSlice, error) {
+	known := migrationMap(all)
+	pending := make(map[string]int, len(unapplied))
+	for i := range unapplied {
+		pending[unapplied[i].Name] = i
+	}
+
+	numDeps := make([]int, len(unapplied))
+	dependents := make([][]int, len(unapplied))
+	for i := range unapplied {
+		for _, dep := range unapplied[i].DependsOn {
+			if _, ok := known[dep]; !ok {
+				return nil, fmt.Errorf("migrate: migration %s depends on unknown migration %s",
+					unapplied[i].Name, dep)
+			}
+			j, ok := pending[dep]
+			if !ok { // already applied
+				continue
+			}
+			numDeps[i]++
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+
+	sorted := make(MigrationSlice, 0, len(unapplied))
+	done := make([]bool, len(unapplied))
+	for len(sorted) < len(unapplied) {
+		next := -1
+		for i := range unapplied {
+			if !done[i] && numDeps[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next == -1 {
+			cycle := findCycle(unapplied, pending, done)
+			return nil, fmt.Errorf("migrate: migrations have a dependency cycle: %s",
+				strings.Join(cycle, " -> "))
+		}
+
+		done[next] = true
+		sorted = append(sorted, unapplied[next])
+		for _, i := range dependents[next] {
+			numDeps[i]--
+		}
+	}
+	return sorted, nil
+}
+
+// findCycle follows the dependencies of the remaining migrations until a migration repeats.
+func findCycle(ms MigrationSlice, pending map[string]int, done []bool) []string {
+	var path []string
+	visited := make(map[int]int)
+
+	i := -1
+	for j := range ms {
+		if !done[j] {
+			i = j
+			break
+		}
+	}
+
+	for i != -1 {
+		if pos, ok := visited[i]; ok {
+			return append(path[pos:], ms[i].Name)
+		}
+		visited[i] = len(path)
+		path = append(path, ms[i].Name)
+
+		next := -1
+		for _, dep := range ms[i].DependsOn {
+			if j, ok := pending[dep]; ok && !done[j] {
+				next = j
+				break
+			}
+		}
+		i = next
+	}
+	return path
+}
+
 func sortAsc(ms MigrationSlice) {
 	sort.Slice(ms, func(i, j int) bool {
 		return ms[i].Name < ms[j].Name
@@ -0,0 +1,84 @@
+package migrate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSortDeps(t *testing.T) {
+	ms := MigrationSlice{
+		{Name: "1", DependsOn: []string{"3"}},
+		{Name: "2"},
+		{Name: "3"},
+		{Name: "4", DependsOn: []string{"1", "0"}},
+	}
+	all := append(MigrationSlice{{ID: 1, Name: "0"}}, ms...)
+
+	sorted, err := sortDeps(all, ms)
+	require.NoError(t, err)
+
+	var names []string
+	for _, m := range sorted {
+		names = append(names, m.Name)
+	}
+	require.Equal(t, []string{"2", "3", "1", "4"}, names)
+}
+
+func TestSortDepsUnknown(t *testing.T) {
+	ms := MigrationSlice{
+		{Name: "1", DependsOn: []string{"2"}},
+	}
+	_, err := sortDeps(ms, ms)
+	require.EqualError(t, err, "migrate: migration 1 depends on unknown migration 2")
+}
+
+func TestSortDepsCycle(t *testing.T) {
+	ms := MigrationSlice{
+		{Name: "1"},
+		{Name: "2", DependsOn: []string{"4"}},
+		{Name: "3", DependsOn: []string{"2"}},
+		{Name: "4", DependsOn: []string{"3"}},
+	}
+	_, err := sortDeps(ms, ms)
+	require.EqualError(t, err, "migrate: migrations have a dependency cycle: 2 -> 4 -> 3 -> 2")
+}
+
+func TestMigrationSlice(t *testing.T) {
+	ms := MigrationSlice{
+		{Name: "3"},
+		{ID: 2, Name: "2", GroupID: 2},
+		{Name: "4"},
+		{ID: 1, Name: "1", GroupID: 1},
+	}
+
+	names := func(ms MigrationSlice) []string {
+		var names []string
+		for _, m := range ms {
+			names = append(names, m.Name)
+		}
+		return names
+	}
+
+	require.Equal(t, []string{"2", "1"}, names(ms.Applied()))
+	require.Equal(t, []string{"3", "4"}, names(ms.Unapplied()))
+	require.Equal(t, int64(2), ms.LastGroupID())
+	require.Equal(t, int64(0), MigrationSlice{{Name: "1"}}.LastGroupID())
+
+	ms.SortByName()
+	require.Equal(t, []string{"1", "2", "3", "4"}, names(ms))
+}
+
+func TestMigrationGroupString(t *testing.T) {
+	group := MigrationGroup{
+		ID: 2,
+		Migrations: MigrationSlice{
+			{Name: "20060102150405", Comment: "create_users"},
+			{Name: "20060102160405", Comment: "add_email"},
+		},
+	}
+	require.Equal(t,
+		"group #2 (migrations: 20060102150405_create_users, 20060102160405_add_email)",
+		group.String())
+	require.Equal(t, "nil", MigrationGroup{}.String())
+}
@@ -1,6 +1,7 @@
 package migrate
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	"io/fs"
@@ -19,11 +20,23 @@ func WithMigrationsDirectory(directory string) MigrationsOption {
 	}
 }
 
+// WithMigrationNameFunc sets the function that generates the version part of
+// new migration names, e.g. a monotonic counter or a nanosecond timestamp.
+// The version must consist of digits. By default, the current UTC time
+// in the 20060102150405 format is used.
+func WithMigrationNameFunc(fn func() string) MigrationsOption {
+	return func(m *Migrations) {
+		m.nameFunc = fn
+	}
+}
+
 type Migrations struct {
 	ms MigrationSlice
 
 	explicitDirectory string
 	implicitDirectory string
+
+	nameFunc func() string
 }
 
 func NewMigrations(opts ...MigrationsOption) *Migrations {
@@ -72,11 +85,34 @@ func (m *Migrations) Add(migration Migration) {
 	m.ms = append(m.ms, migration)
 }
 
+// Merge adds the migrations registered in other, for example, migrations shipped
+// by a shared library. It fails without adding anything if both sets contain
+// a migration with the same name.
+func (m *Migrations) Merge(other *Migrations) error {
+	names := migrationMap(m.ms)
+	for i := range other.ms {
+		if _, ok := names[other.ms[i].Name]; ok {
+			return fmt.Errorf("migrate: migration %s is already registered", other.ms[i].Name)
+		}
+	}
+	m.ms = append(m.ms, other.ms...)
+	return nil
+}
+
 func (m *Migrations) DiscoverCaller() error {
 	dir := filepath.Dir(migrationFile())
 	return m.Discover(os.DirFS(dir))
 }
 
+// Discover registers SQL migrations (*.up.sql and *.down.sql files) found in the fsys,
+// for example, os.DirFS or an embed.FS with the migration files:
+//
+//	//go:embed *.sql
+//	var sqlMigrations embed.FS
+//
+//	if err := Migrations.Discover(sqlMigrations); err != nil {
+//		panic(err)
+//	}
 func (m *Migrations) Discover(fsys fs.FS) error {
 	return fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
@@ -104,11 +140,21 @@ func (m *Migrations) Discover(fsys fs.FS) error {
 		migrationFunc := NewSQLMigrationFunc(fsys, path)
 
 		if strings.HasSuffix(path, ".up.sql") {
+			description, err := readCommentDirective(fsys, path)
+			if err != nil {
+				return err
+			}
+			if description != "" {
+				migration.Description = description
+			}
+
 			migration.Up = migrationFunc
+			migration.upFile = &sqlMigrationFile{fsys: fsys, name: path}
 			return nil
 		}
 		if strings.HasSuffix(path, ".down.sql") {
 			migration.Down = migrationFunc
+			migration.downFile = &sqlMigrationFile{fsys: fsys, name: path}
 			return nil
 		}
 
@@ -116,6 +162,43 @@ func (m *Migrations) Discover(fsys fs.FS) error {
 	})
 }
 
+// readCommentDirective returns the description from a "--bun:comment" line
+// at the top of the SQL migration file.
+func readCommentDirective(fsys fs.FS, name string) (string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	const prefix = "--bun:comment"
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, prefix) {
+			return strings.TrimSpace(strings.TrimPrefix(line, prefix)), nil
+		}
+		break
+	}
+	return "", scanner.Err()
+}
+
+// replace replaces the old migrations with the migration.
+func (m *Migrations) replace(old MigrationSlice, migration Migration) {
+	names := migrationMap(old)
+	ms := m.ms[:0]
+	for i := range m.ms {
+		if _, ok := names[m.ms[i].Name]; !ok {
+			ms = append(ms, m.ms[i])
+		}
+	}
+	m.ms = append(ms, migration)
+}
+
 func (m *Migrations) getOrCreateMigration(name string) *Migration {
 	for i := range m.ms {
 		m := &m.ms[i]
@@ -157,7 +240,7 @@ func migrationFile() string {
 	return ""
 }
 
-var fnameRE = regexp.MustCompile(`^(\d{1,14})_([0-9a-z_\-]+)\.`)
+var fnameRE = regexp.MustCompile(`^(\d+)_([0-9a-z_\-]+)\.`)
 
 func extractMigrationName(fpath string) (string, string, error) {
 	fname := filepath.Base(fpath)
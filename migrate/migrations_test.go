@@ -0,0 +1,84 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscoverFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"20060102150405_create_users.up.sql":       {Data: []byte("SELECT 1\n")},
+		"20060102150405_create_users.down.sql":     {Data: []byte("SELECT 2\n")},
+		"sql/20060102160405_add_email.tx.up.sql":   {Data: []byte("SELECT 3\n")},
+		"sql/20060102160405_add_email.tx.down.sql": {Data: []byte("SELECT 4\n")},
+		"README.md": {Data: []byte("not a migration")},
+	}
+
+	migrations := NewMigrations()
+	err := migrations.Discover(fsys)
+	require.NoError(t, err)
+
+	ms := migrations.Sorted()
+	require.Len(t, ms, 2)
+
+	require.Equal(t, "20060102150405", ms[0].Name)
+	require.Equal(t, "create_users", ms[0].Comment)
+	require.NotNil(t, ms[0].Up)
+	require.NotNil(t, ms[0].Down)
+
+	require.Equal(t, "20060102160405", ms[1].Name)
+	require.Equal(t, "add_email", ms[1].Comment)
+
+	queries, err := ms[1].upFile.queries()
+	require.NoError(t, err)
+	require.Equal(t, []string{"SELECT 3\n"}, queries)
+}
+
+func TestDiscoverCommentDirective(t *testing.T) {
+	fsys := fstest.MapFS{
+		"20060102150405_users.up.sql": {
+			Data: []byte("\n--bun:comment add users email index\nSELECT 1\n"),
+		},
+		"20060102150405_users.down.sql": {Data: []byte("SELECT 2\n")},
+		"20060102160405_orders.up.sql": {
+			Data: []byte("SELECT 3\n--bun:comment not leading\n"),
+		},
+	}
+
+	migrations := NewMigrations()
+	err := migrations.Discover(fsys)
+	require.NoError(t, err)
+
+	ms := migrations.Sorted()
+	require.Len(t, ms, 2)
+	require.Equal(t, "users", ms[0].Comment)
+	require.Equal(t, "add users email index", ms[0].Description)
+	require.Equal(t, "orders", ms[1].Comment)
+	require.Equal(t, "", ms[1].Description)
+
+	queries, err := ms[0].upFile.queries()
+	require.NoError(t, err)
+	require.Equal(t, []string{"\nSELECT 1\n"}, queries)
+}
+
+func TestMigrationsMerge(t *testing.T) {
+	shared := NewMigrations()
+	shared.Add(Migration{Name: "20060102150405", Comment: "shared"})
+
+	app := NewMigrations()
+	app.Add(Migration{Name: "20060102160405", Comment: "app"})
+
+	err := app.Merge(shared)
+	require.NoError(t, err)
+
+	ms := app.Sorted()
+	require.Len(t, ms, 2)
+	require.Equal(t, "shared", ms[0].Comment)
+	require.Equal(t, "app", ms[1].Comment)
+
+	err = app.Merge(shared)
+	require.EqualError(t, err, "migrate: migration 20060102150405 is already registered")
+	require.Len(t, app.Sorted(), 2)
+}
@@ -4,12 +4,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"io/ioutil"
 	"path/filepath"
+	"reflect"
 	"regexp"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/dialect/sqltype"
 )
 
 type MigratorOption func(m *Migrator)
@@ -26,6 +32,15 @@ func WithLocksTableName(table string) MigratorOption {
 	}
 }
 
+// WithTableSchema sets the schema of the migrations and migration locks tables,
+// for example, "migrations" to use "migrations.bun_migrations".
+// The schema must already exist.
+func WithTableSchema(schema string) MigratorOption {
+	return func(m *Migrator) {
+		m.tableSchema = schema
+	}
+}
+
 // WithMarkAppliedOnSuccess sets the migrator to only mark migrations as applied/unapplied
 // when their up/down is successful
 func WithMarkAppliedOnSuccess(enabled bool) MigratorOption {
@@ -34,6 +49,169 @@ func WithMarkAppliedOnSuccess(enabled bool) MigratorOption {
 	}
 }
 
+// WithTableComment sets a comment on the migrations and migration locks tables,
+// for example, "managed by bun migrate - do not edit". The comment is applied by Init
+// on every call so changing it updates existing tables.
+// Table comments are only supported on PostgreSQL and MySQL; other dialects ignore it.
+func WithTableComment(comment string) MigratorOption {
+	return func(m *Migrator) {
+		m.tableComment = comment
+	}
+}
+
+// LockStrategy specifies how Migrator.Lock prevents concurrent migrations.
+type LockStrategy int
+
+const (
+	// TableLock inserts a row into the migration locks table. It works with all dialects.
+	TableLock LockStrategy = iota
+	// AdvisoryLock uses a PostgreSQL session-level advisory lock keyed on a hash of
+	// the migrations table name. The lock is held by a dedicated connection until Unlock,
+	// so it is released by the database when the process dies. Other dialects use TableLock.
+	AdvisoryLock
+)
+
+// WithLockStrategy sets the strategy used by Lock and Unlock. The default is TableLock.
+func WithLockStrategy(strategy LockStrategy) MigratorOption {
+	return func(m *Migrator) {
+		m.lockStrategy = strategy
+	}
+}
+
+// ErrLockTimeout is returned by Lock when the lock could not be acquired
+// within the duration set by WithLockTimeout.
+var ErrLockTimeout = errors.New("migrate: timed out waiting for the migrations lock")
+
+// WithLockTimeout makes Lock retry until the lock is acquired or the timeout elapses,
+// in which case Lock returns an error wrapping ErrLockTimeout.
+// By default Lock fails immediately if the migrations are already locked.
+func WithLockTimeout(d time.Duration) MigratorOption {
+	return func(m *Migrator) {
+		m.lockTimeout = d
+	}
+}
+
+// WithLockRetryInterval sets how often Lock retries when WithLockTimeout is used.
+// The default is 1 second.
+func WithLockRetryInterval(d time.Duration) MigratorOption {
+	return func(m *Migrator) {
+		m.lockRetryInterval = d
+	}
+}
+
+// WithOnLock sets a callback that is called after Lock acquires the lock,
+// for example, to log when a deploy takes the migration lock.
+func WithOnLock(fn func()) MigratorOption {
+	return func(m *Migrator) {
+		m.onLock = fn
+	}
+}
+
+// WithOnUnlock sets a callback that is called after Unlock releases the lock.
+func WithOnUnlock(fn func()) MigratorOption {
+	return func(m *Migrator) {
+		m.onUnlock = fn
+	}
+}
+
+// Direction specifies whether a migration is applied or rolled back.
+type Direction int
+
+const (
+	DirectionUp Direction = iota
+	DirectionDown
+)
+
+func (d Direction) String() string {
+	switch d {
+	case DirectionUp:
+		return "up"
+	case DirectionDown:
+		return "down"
+	default:
+		return "invalid"
+	}
+}
+
+// MigrationError is returned by Migrate and Rollback when the Up or Down func
+// of a migration fails. It unwraps to the error returned by the func.
+type MigrationError struct {
+	Name      string
+	Direction Direction
+	GroupID   int64
+	Err       error
+}
+
+func (e *MigrationError) Error() string {
+	return fmt.Sprintf("migrate: migration %s (%s) in group #%d failed: %s",
+		e.Name, e.Direction, e.GroupID, e.Err)
+}
+
+func (e *MigrationError) Unwrap() error {
+	return e.Err
+}
+
+// MigrationHook is called before a migration is applied or rolled back.
+type MigrationHook func(ctx context.Context, migration Migration, direction Direction) error
+
+// AfterMigrationHook is called after a migration is applied or rolled back
+// with the error returned by the migration and the time it took.
+type AfterMigrationHook func(
+	ctx context.Context, migration Migration, direction Direction, err error, dur time.Duration,
+)
+
+// WithMigrationHook adds a hook that is called before each Up and Down.
+// Returning an error aborts the migration before it is marked as applied or unapplied.
+func WithMigrationHook(hook MigrationHook) MigratorOption {
+	return func(m *Migrator) {
+		m.beforeHooks = append(m.beforeHooks, hook)
+	}
+}
+
+// WithAfterMigrationHook adds a hook that is called after each Up and Down.
+func WithAfterMigrationHook(hook AfterMigrationHook) MigratorOption {
+	return func(m *Migrator) {
+		m.afterHooks = append(m.afterHooks, hook)
+	}
+}
+
+// PreMigrateHook is called once before Migrate applies the unapplied migrations.
+type PreMigrateHook func(ctx context.Context) error
+
+// PostMigrateHook is called once after Migrate applied the migrations or failed.
+type PostMigrateHook func(ctx context.Context, group *MigrationGroup, err error)
+
+// WithPreMigrateHook adds a hook that Migrate, MigrateOne and Baseline call before
+// the first migration, for example, to route reads away from replicas that are about to lag.
+// Returning an error aborts before any migration is applied and, with WithLock,
+// before the lock is acquired.
+// Hooks are not called when there is nothing to migrate or with WithDryRun.
+func WithPreMigrateHook(hook PreMigrateHook) MigratorOption {
+	return func(m *Migrator) {
+		m.preMigrateHooks = append(m.preMigrateHooks, hook)
+	}
+}
+
+// WithPostMigrateHook adds a hook that Migrate, MigrateOne and Baseline call after
+// the last migration with the applied group and the error, if any. It is called whenever
+// the pre-migrate hooks succeeded, even if a migration fails.
+func WithPostMigrateHook(hook PostMigrateHook) MigratorOption {
+	return func(m *Migrator) {
+		m.postMigrateHooks = append(m.postMigrateHooks, hook)
+	}
+}
+
+// WithTransactions makes Migrate and Rollback run each migration together with the update
+// of the migrations table in a transaction that is rolled back if the migration fails.
+// SQL migrations and Go migrations defined with UpTx and DownTx use the transaction.
+// Go migrations defined with Up and Down get *bun.DB, so they run without it.
+// MySQL implicitly commits DDL statements, so the option has no effect there.
+func WithTransactions(enabled bool) MigratorOption {
+	return func(m *Migrator) {
+		m.transactions = enabled
+	}
+}
+
 type Migrator struct {
 	db         *bun.DB
 	migrations *Migrations
@@ -42,7 +220,26 @@ type Migrator struct {
 
 	table                string
 	locksTable           string
+	tableSchema          string
 	markAppliedOnSuccess bool
+	transactions         bool
+	tableComment         string
+
+	upgradeMu sync.Mutex
+	upgraded  bool
+
+	lockStrategy LockStrategy
+	lockConn     *bun.Conn
+
+	lockTimeout       time.Duration
+	lockRetryInterval time.Duration
+	onLock            func()
+	onUnlock          func()
+
+	beforeHooks      []MigrationHook
+	afterHooks       []AfterMigrationHook
+	preMigrateHooks  []PreMigrateHook
+	postMigrateHooks []PostMigrateHook
 }
 
 func NewMigrator(db *bun.DB, migrations *Migrations, opts ...MigratorOption) *Migrator {
@@ -54,10 +251,16 @@ func NewMigrator(db *bun.DB, migrations *Migrations, opts ...MigratorOption) *Mi
 
 		table:      "bun_migrations",
 		locksTable: "bun_migration_locks",
+
+		lockRetryInterval: time.Second,
 	}
 	for _, opt := range opts {
 		opt(m)
 	}
+	if m.tableSchema != "" {
+		m.table = m.tableSchema + "." + m.table
+		m.locksTable = m.tableSchema + "." + m.locksTable
+	}
 	return m
 }
 
@@ -86,12 +289,56 @@ func (m *Migrator) migrationsWithStatus(ctx context.Context) (MigrationSlice, in
 			m1.ID = m2.ID
 			m1.GroupID = m2.GroupID
 			m1.MigratedAt = m2.MigratedAt
+			m1.DurationMS = m2.DurationMS
+			if m2.Author != "" {
+				m1.Author = m2.Author
+			}
+			if m1.Description == "" {
+				m1.Description = m2.Description
+			}
 		}
 	}
 
 	return sorted, applied.LastGroupID(), nil
 }
 
+// Status describes the migration state of the database.
+type Status struct {
+	// LastGroupID is the id of the last applied migration group or 0.
+	LastGroupID int64 `json:"last_group_id"`
+	// UnappliedCount is the number of migrations that have not been applied yet.
+	UnappliedCount int `json:"unapplied_count"`
+	// Unapplied contains names of unapplied migrations in ascending order.
+	Unapplied []string `json:"unapplied"`
+	// Locked reports whether the migrations table is locked.
+	Locked bool `json:"locked"`
+}
+
+// Status returns the migration state of the database. It does not acquire the lock.
+func (m *Migrator) Status(ctx context.Context) (Status, error) {
+	migrations, lastGroupID, err := m.migrationsWithStatus(ctx)
+	if err != nil {
+		return Status{}, err
+	}
+
+	unapplied := migrations.Unapplied()
+	status := Status{
+		LastGroupID:    lastGroupID,
+		UnappliedCount: len(unapplied),
+		Unapplied:      make([]string, 0, len(unapplied)),
+	}
+	for i := range unapplied {
+		status.Unapplied = append(status.Unapplied, unapplied[i].Name)
+	}
+
+	status.Locked, err = m.isLocked(ctx)
+	if err != nil {
+		return Status{}, err
+	}
+
+	return status, nil
+}
+
 func (m *Migrator) Init(ctx context.Context) error {
 	if _, err := m.db.NewCreateTable().
 		Model((*Migration)(nil)).
@@ -100,6 +347,9 @@ func (m *Migrator) Init(ctx context.Context) error {
 		Exec(ctx); err != nil {
 		return err
 	}
+	if err := m.upgradeTable(ctx); err != nil {
+		return err
+	}
 	if _, err := m.db.NewCreateTable().
 		Model((*migrationLock)(nil)).
 		ModelTableExpr(m.locksTable).
@@ -107,9 +357,115 @@ func (m *Migrator) Init(ctx context.Context) error {
 		Exec(ctx); err != nil {
 		return err
 	}
+	if m.tableComment != "" {
+		for _, table := range []string{m.table, m.locksTable} {
+			if err := m.commentTable(ctx, table); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
+// addColumnIfNotExists adds a Migration column to a migrations table
+// that was created by an older version of the migrator.
+// upgradeTable adds the columns that are missing in migrations tables created by
+// older versions. Methods that write to the table call it, so upgrading does not
+// require calling Init again. The table is only checked once per Migrator.
+func (m *Migrator) upgradeTable(ctx context.Context) error {
+	m.upgradeMu.Lock()
+	defer m.upgradeMu.Unlock()
+
+	if m.upgraded {
+		return nil
+	}
+	for _, column := range []string{"duration_ms", "author", "description"} {
+		if err := m.addColumnIfNotExists(ctx, column); err != nil {
+			return err
+		}
+	}
+	m.upgraded = true
+	return nil
+}
+
+func (m *Migrator) addColumnIfNotExists(ctx context.Context, column string) error {
+	exists, err := columnExists(ctx, m.db, m.table, column)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	table := m.db.Table(reflect.TypeOf((*Migration)(nil)).Elem())
+	field, ok := table.FieldMap[column]
+	if !ok {
+		return fmt.Errorf("migrate: Migration does not have column %q", column)
+	}
+
+	sqlType := field.CreateTableSQLType
+	if strings.EqualFold(sqlType, sqltype.VarChar) {
+		if n := m.db.Dialect().DefaultVarcharLen(); n > 0 {
+			sqlType = fmt.Sprintf("%s(%d)", sqlType, n)
+		}
+	}
+
+	_, err = m.db.NewAddColumn().
+		Model((*Migration)(nil)).
+		ModelTableExpr(m.table).
+		ColumnExpr("? ?", bun.Ident(column), bun.Safe(sqlType)).
+		Exec(ctx)
+	return err
+}
+
+// columnExists checks the catalog for the column. Probing the column with a query does not
+// work on SQLite, which treats an unknown quoted identifier as a string literal.
+func columnExists(ctx context.Context, db bun.IDB, table, column string) (bool, error) {
+	var schema string
+	if i := strings.LastIndexByte(table, '.'); i >= 0 {
+		schema, table = table[:i], table[i+1:]
+	}
+	schema = strings.Trim(schema, "\"`")
+	table = strings.Trim(table, "\"`")
+
+	if db.Dialect().Name() == dialect.SQLite {
+		return db.NewSelect().
+			TableExpr("pragma_table_info(?)", table).
+			Where("name = ?", column).
+			Exists(ctx)
+	}
+
+	q := db.NewSelect().
+		TableExpr("information_schema.columns").
+		Where("table_name = ?", table).
+		Where("column_name = ?", column)
+	switch {
+	case schema != "":
+		q = q.Where("table_schema = ?", schema)
+	case db.Dialect().Name() == dialect.MySQL:
+		q = q.Where("table_schema = DATABASE()")
+	case db.Dialect().Name() == dialect.MSSQL:
+		q = q.Where("table_schema = SCHEMA_NAME()")
+	default:
+		q = q.Where("table_schema = current_schema()")
+	}
+	return q.Exists(ctx)
+}
+
+func (m *Migrator) commentTable(ctx context.Context, table string) error {
+	var query string
+	switch m.db.Dialect().Name() {
+	case dialect.PG:
+		query = "COMMENT ON TABLE ? IS ?"
+	case dialect.MySQL:
+		query = "ALTER TABLE ? COMMENT = ?"
+	default:
+		return nil
+	}
+	_, err := m.db.NewRaw(query, bun.Safe(table), m.tableComment).Exec(ctx)
+	return err
+}
+
 func (m *Migrator) Reset(ctx context.Context) error {
 	if _, err := m.db.NewDropTable().
 		Model((*Migration)(nil)).
@@ -129,6 +485,8 @@ func (m *Migrator) Reset(ctx context.Context) error {
 }
 
 // Migrate runs unapplied migrations. If a migration fails, migrate immediately exits.
+// If the ctx is canceled, Migrate stops before the next migration and returns
+// the migrations applied so far together with the ctx error.
 func (m *Migrator) Migrate(ctx context.Context, opts ...MigrationOption) (*MigrationGroup, error) {
 	cfg := newMigrationConfig(opts)
 
@@ -136,11 +494,10 @@ func (m *Migrator) Migrate(ctx context.Context, opts ...MigrationOption) (*Migra
 		return nil, err
 	}
 
-	migrations, lastGroupID, err := m.migrationsWithStatus(ctx)
+	all, migrations, lastGroupID, err := m.unappliedMigrations(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
-	migrations = migrations.Unapplied()
 
 	group := new(MigrationGroup)
 	if len(migrations) == 0 {
@@ -148,32 +505,164 @@ func (m *Migrator) Migrate(ctx context.Context, opts ...MigrationOption) (*Migra
 	}
 	group.ID = lastGroupID + 1
 
+	if cfg.dryRun {
+		for i := range migrations {
+			migration := &migrations[i]
+			migration.GroupID = group.ID
+
+			if migration.upFile != nil {
+				queries, err := migration.upFile.queries()
+				if err != nil {
+					return nil, err
+				}
+				migration.SQL = queries
+			}
+		}
+		group.Migrations = migrations
+		return group, nil
+	}
+
+	if err := m.upgradeTable(ctx); err != nil {
+		return group, err
+	}
+
+	err = m.withMigrateHooks(ctx, cfg.lock, group, func() error {
+		if cfg.lock {
+			// Other processes may have applied migrations before the lock was acquired.
+			all, migrations, lastGroupID, err = m.unappliedMigrations(ctx, cfg)
+			if err != nil {
+				return err
+			}
+			if len(migrations) == 0 {
+				group.ID = 0
+				return nil
+			}
+			group.ID = lastGroupID + 1
+		}
+
+		if err := m.migrateGroup(ctx, cfg, group, migrations); err != nil {
+			return err
+		}
+		return m.dropStaleBackups(ctx, all)
+	})
+	return group, err
+}
+
+// unappliedMigrations returns all migrations and the unapplied ones in the order
+// in which Migrate applies them.
+func (m *Migrator) unappliedMigrations(
+	ctx context.Context, cfg *migrationConfig,
+) (all, unapplied MigrationSlice, lastGroupID int64, _ error) {
+	all, lastGroupID, err := m.migrationsWithStatus(ctx)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	unapplied, err = sortDeps(all, all.Unapplied())
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if cfg.steps > 0 && len(unapplied) > cfg.steps {
+		unapplied = unapplied[:cfg.steps]
+	}
+	return all, unapplied, lastGroupID, nil
+}
+
+// withMigrateHooks calls fn between the pre-migrate and post-migrate hooks.
+// With lock, the lock is acquired after the pre-migrate hooks, so a failing hook
+// aborts before waiting for the lock, and it is released before the post-migrate hooks.
+func (m *Migrator) withMigrateHooks(
+	ctx context.Context, lock bool, group *MigrationGroup, fn func() error,
+) error {
+	for _, hook := range m.preMigrateHooks {
+		if err := hook(ctx); err != nil {
+			return err
+		}
+	}
+
+	err := m.runLocked(ctx, lock, fn)
+
+	for _, hook := range m.postMigrateHooks {
+		hook(ctx, group, err)
+	}
+	return err
+}
+
+func (m *Migrator) runLocked(ctx context.Context, lock bool, fn func() error) error {
+	if !lock {
+		return fn()
+	}
+
+	if err := m.Lock(ctx); err != nil {
+		return err
+	}
+	err := fn()
+	if unlockErr := m.Unlock(ctx); err == nil {
+		err = unlockErr
+	}
+	return err
+}
+
+// migrateGroup applies the migrations in the group.
+func (m *Migrator) migrateGroup(
+	ctx context.Context, cfg *migrationConfig, group *MigrationGroup, migrations MigrationSlice,
+) error {
 	for i := range migrations {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		migration := &migrations[i]
 		migration.GroupID = group.ID
 
-		if !m.markAppliedOnSuccess {
-			if err := m.MarkApplied(ctx, migration); err != nil {
-				return group, err
+		run := !cfg.nop && migration.hasFunc(DirectionUp)
+		if run && migration.Skip != nil {
+			skip, err := migration.Skip(ctx, m.db)
+			if err != nil {
+				return err
 			}
+			run = !skip
 		}
 
-		group.Migrations = migrations[:i+1]
-
-		if !cfg.nop && migration.Up != nil {
-			if err := migration.Up(ctx, m.db); err != nil {
-				return group, err
+		if run {
+			if err := m.beforeMigration(ctx, migration, DirectionUp); err != nil {
+				return err
 			}
 		}
 
-		if m.markAppliedOnSuccess {
-			if err := m.MarkApplied(ctx, migration); err != nil {
-				return group, err
+		if err := m.inTx(ctx, migration, DirectionUp, func(ctx context.Context, db bun.IDB) error {
+			if !m.markAppliedOnSuccess {
+				if err := m.markApplied(ctx, db, migration); err != nil {
+					return err
+				}
 			}
+
+			group.Migrations = migrations[:i+1]
+
+			if run {
+				if err := m.backupData(ctx, db, migration); err != nil {
+					return err
+				}
+				if err := m.runMigration(ctx, db, migration, DirectionUp); err != nil {
+					return err
+				}
+				if !m.markAppliedOnSuccess {
+					if err := m.updateDuration(ctx, db, migration); err != nil {
+						return err
+					}
+				}
+			}
+
+			if m.markAppliedOnSuccess {
+				if err := m.markApplied(ctx, db, migration); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
 		}
 	}
-
-	return group, nil
+	return nil
 }
 
 func (m *Migrator) Rollback(ctx context.Context, opts ...MigrationOption) (*MigrationGroup, error) {
@@ -189,30 +678,339 @@ func (m *Migrator) Rollback(ctx context.Context, opts ...MigrationOption) (*Migr
 	}
 
 	lastGroup := migrations.LastGroup()
+	if n := len(lastGroup.Migrations); cfg.steps > 0 && n > cfg.steps {
+		lastGroup.Migrations = lastGroup.Migrations[n-cfg.steps:]
+	}
+	if err := m.rollbackGroup(ctx, cfg, lastGroup); err != nil {
+		return lastGroup, err
+	}
+	return lastGroup, nil
+}
+
+// RollbackTo rolls back migration groups, newest first, until the migration with the given
+// name is the last applied migration. Migrations that were applied after the named migration
+// in the same group are rolled back too. Like Rollback, it expects the caller to hold the lock.
+func (m *Migrator) RollbackTo(
+	ctx context.Context, name string, opts ...MigrationOption,
+) ([]*MigrationGroup, error) {
+	cfg := newMigrationConfig(opts)
+
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+
+	migrations, err := m.MigrationsWithStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	target, ok := migrationMap(migrations)[name]
+	if !ok || !target.IsApplied() {
+		return nil, fmt.Errorf("migrate: migration %s is not applied", name)
+	}
+
+	var newer MigrationSlice
+	for i := range migrations {
+		if migrations[i].IsApplied() && migrations[i].ID > target.ID {
+			newer = append(newer, migrations[i])
+		}
+	}
+
+	var groups []*MigrationGroup
+	for len(newer) > 0 {
+		group := newer.LastGroup()
+		groups = append(groups, group)
+
+		if err := m.rollbackGroup(ctx, cfg, group); err != nil {
+			return groups, err
+		}
+
+		remaining := newer[:0]
+		for i := range newer {
+			if newer[i].GroupID != group.ID {
+				remaining = append(remaining, newer[i])
+			}
+		}
+		newer = remaining
+	}
+
+	return groups, nil
+}
+
+// MigrateOne applies only the named migration in a new group. It fails if the migration
+// is already applied or depends on migrations that are not applied yet.
+func (m *Migrator) MigrateOne(
+	ctx context.Context, name string, opts ...MigrationOption,
+) (*MigrationGroup, error) {
+	cfg := newMigrationConfig(opts)
+
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+
+	all, migration, lastGroupID, err := m.migrationToApply(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.upgradeTable(ctx); err != nil {
+		return nil, err
+	}
+
+	group := &MigrationGroup{ID: lastGroupID + 1}
+	err = m.withMigrateHooks(ctx, cfg.lock, group, func() error {
+		if cfg.lock {
+			// Other processes may have applied the migration before the lock was acquired.
+			all, migration, lastGroupID, err = m.migrationToApply(ctx, name)
+			if err != nil {
+				return err
+			}
+			group.ID = lastGroupID + 1
+		}
+
+		if err := m.migrateGroup(ctx, cfg, group, MigrationSlice{*migration}); err != nil {
+			return err
+		}
+		return m.dropStaleBackups(ctx, all)
+	})
+	return group, err
+}
 
-	for i := len(lastGroup.Migrations) - 1; i >= 0; i-- {
-		migration := &lastGroup.Migrations[i]
+// migrationToApply returns all migrations and the named migration after checking
+// that MigrateOne can apply it.
+func (m *Migrator) migrationToApply(
+	ctx context.Context, name string,
+) (all MigrationSlice, _ *Migration, lastGroupID int64, _ error) {
+	all, lastGroupID, err := m.migrationsWithStatus(ctx)
+	if err != nil {
+		return nil, nil, 0, err
+	}
 
-		if !m.markAppliedOnSuccess {
-			if err := m.MarkUnapplied(ctx, migration); err != nil {
-				return lastGroup, err
+	byName := migrationMap(all)
+	migration, ok := byName[name]
+	if !ok {
+		return nil, nil, 0, fmt.Errorf("migrate: migration %s not found", name)
+	}
+	if migration.IsApplied() {
+		return nil, nil, 0, fmt.Errorf("migrate: migration %s is already applied", name)
+	}
+	for _, dep := range migration.DependsOn {
+		if m2, ok := byName[dep]; !ok || !m2.IsApplied() {
+			return nil, nil, 0, fmt.Errorf(
+				"migrate: migration %s depends on unapplied migration %s", name, dep)
+		}
+	}
+	return all, migration, lastGroupID, nil
+}
+
+// RollbackOne rolls back only the named migration. It fails if the migration is not applied
+// or an applied migration depends on it.
+func (m *Migrator) RollbackOne(
+	ctx context.Context, name string, opts ...MigrationOption,
+) (*MigrationGroup, error) {
+	cfg := newMigrationConfig(opts)
+
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+
+	migrations, err := m.MigrationsWithStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	migration, ok := migrationMap(migrations)[name]
+	if !ok || !migration.IsApplied() {
+		return nil, fmt.Errorf("migrate: migration %s is not applied", name)
+	}
+	for i := range migrations {
+		if !migrations[i].IsApplied() {
+			continue
+		}
+		for _, dep := range migrations[i].DependsOn {
+			if dep == name {
+				return nil, fmt.Errorf("migrate: applied migration %s depends on migration %s",
+					migrations[i].Name, name)
 			}
 		}
+	}
+
+	group := &MigrationGroup{
+		ID:         migration.GroupID,
+		Migrations: MigrationSlice{*migration},
+	}
+	if err := m.rollbackGroup(ctx, cfg, group); err != nil {
+		return group, err
+	}
+	return group, nil
+}
+
+func (m *Migrator) rollbackGroup(
+	ctx context.Context, cfg *migrationConfig, group *MigrationGroup,
+) error {
+	for i := len(group.Migrations) - 1; i >= 0; i-- {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		migration := &group.Migrations[i]
+		run := !cfg.nop && migration.hasFunc(DirectionDown)
 
-		if !cfg.nop && migration.Down != nil {
-			if err := migration.Down(ctx, m.db); err != nil {
-				return lastGroup, err
+		if run {
+			if err := m.beforeMigration(ctx, migration, DirectionDown); err != nil {
+				return err
 			}
 		}
 
-		if m.markAppliedOnSuccess {
-			if err := m.MarkUnapplied(ctx, migration); err != nil {
-				return lastGroup, err
+		if err := m.inTx(ctx, migration, DirectionDown, func(ctx context.Context, db bun.IDB) error {
+			if !m.markAppliedOnSuccess {
+				if err := m.markUnapplied(ctx, db, migration); err != nil {
+					return err
+				}
 			}
+
+			if run {
+				if err := m.runMigration(ctx, db, migration, DirectionDown); err != nil {
+					return err
+				}
+			}
+			// Backups are restored even without Down, so WithDataBackup alone
+			// is enough to roll back data-only migrations.
+			if !cfg.nop {
+				if err := m.restoreData(ctx, db, migration); err != nil {
+					return err
+				}
+			}
+
+			if m.markAppliedOnSuccess {
+				if err := m.markUnapplied(ctx, db, migration); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	return lastGroup, nil
+// inTx calls fn in a transaction when WithTransactions is enabled and the migration
+// does not disable it or can't run in it. The transaction is also available
+// to the migration via TxFromContext.
+func (m *Migrator) inTx(
+	ctx context.Context,
+	migration *Migration,
+	direction Direction,
+	fn func(ctx context.Context, db bun.IDB) error,
+) error {
+	if !m.transactions || migration.DisableTransaction || !migration.canRunInTx(direction) ||
+		m.db.Dialect().Name() == dialect.MySQL {
+		return fn(ctx, m.db)
+	}
+	return m.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		return fn(contextWithTx(ctx, tx), tx)
+	})
+}
+
+func (m *Migrator) beforeMigration(
+	ctx context.Context, migration *Migration, direction Direction,
+) error {
+	for _, hook := range m.beforeHooks {
+		if err := hook(ctx, *migration, direction); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) runMigration(
+	ctx context.Context, db bun.IDB, migration *Migration, direction Direction,
+) error {
+	start := time.Now()
+	var err error
+	switch {
+	case direction == DirectionUp && migration.UpTx != nil:
+		err = migration.UpTx(ctx, db)
+	case direction == DirectionUp:
+		err = migration.Up(ctx, m.db)
+	case migration.DownTx != nil:
+		err = migration.DownTx(ctx, db)
+	default:
+		err = migration.Down(ctx, m.db)
+	}
+	dur := time.Since(start)
+
+	if direction == DirectionUp {
+		migration.DurationMS = dur.Milliseconds()
+	}
+
+	for _, hook := range m.afterHooks {
+		hook(ctx, *migration, direction, err, dur)
+	}
+	if err != nil {
+		return &MigrationError{
+			Name:      migration.Name,
+			Direction: direction,
+			GroupID:   migration.GroupID,
+			Err:       err,
+		}
+	}
+	return nil
+}
+
+// Baseline marks the unapplied migrations up to and including the named migration as applied
+// in a new group without running them. It is used to adopt an existing database
+// whose schema already matches these migrations.
+func (m *Migrator) Baseline(ctx context.Context, name string) (*MigrationGroup, error) {
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+
+	migrations, lastGroupID, err := m.migrationsWithStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := migrationMap(migrations)[name]; !ok {
+		return nil, fmt.Errorf("migrate: migration %s not found", name)
+	}
+
+	var baseline MigrationSlice
+	for _, migration := range migrations.Unapplied() {
+		if migration.Name <= name {
+			baseline = append(baseline, migration)
+		}
+	}
+
+	group := new(MigrationGroup)
+	if len(baseline) == 0 {
+		return group, nil
+	}
+	group.ID = lastGroupID + 1
+
+	if err := m.upgradeTable(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := m.withMigrateHooks(ctx, false, group, func() error {
+		if err := m.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			for i := range baseline {
+				baseline[i].GroupID = group.ID
+				if err := m.markApplied(ctx, tx, &baseline[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		group.Migrations = baseline
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return group, nil
 }
 
 type goMigrationConfig struct {
@@ -274,12 +1072,30 @@ func (m *Migrator) CreateSQLMigrations(ctx context.Context, name string) ([]*Mig
 		return nil, err
 	}
 
-	up, err := m.createSQL(ctx, name+".up.sql")
+	return m.createSQLMigrations(ctx, name, sqlTemplate)
+}
+
+// CreateEmpty creates an up and down SQL migration files without any statements.
+// Such migration does not change the schema, but it is still recorded as applied
+// so it can be used to start a new migration group, e.g. as a deploy marker.
+func (m *Migrator) CreateEmpty(ctx context.Context, name string) ([]*MigrationFile, error) {
+	name, err := m.genMigrationName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.createSQLMigrations(ctx, name, "")
+}
+
+func (m *Migrator) createSQLMigrations(
+	ctx context.Context, name, content string,
+) ([]*MigrationFile, error) {
+	up, err := m.createSQL(ctx, name+".up.sql", content)
 	if err != nil {
 		return nil, err
 	}
 
-	down, err := m.createSQL(ctx, name+".down.sql")
+	down, err := m.createSQL(ctx, name+".down.sql", content)
 	if err != nil {
 		return nil, err
 	}
@@ -287,22 +1103,25 @@ func (m *Migrator) CreateSQLMigrations(ctx context.Context, name string) ([]*Mig
 	return []*MigrationFile{up, down}, nil
 }
 
-func (m *Migrator) createSQL(ctx context.Context, fname string) (*MigrationFile, error) {
+func (m *Migrator) createSQL(ctx context.Context, fname, content string) (*MigrationFile, error) {
 	fpath := filepath.Join(m.migrations.getDirectory(), fname)
 
-	if err := ioutil.WriteFile(fpath, []byte(sqlTemplate), 0o644); err != nil {
+	if err := ioutil.WriteFile(fpath, []byte(content), 0o644); err != nil {
 		return nil, err
 	}
 
 	mf := &MigrationFile{
 		Name:    fname,
 		Path:    fpath,
-		Content: goTemplate,
+		Content: content,
 	}
 	return mf, nil
 }
 
-var nameRE = regexp.MustCompile(`^[0-9a-z_\-]+$`)
+var (
+	nameRE    = regexp.MustCompile(`^[0-9a-z_\-]+$`)
+	versionRE = regexp.MustCompile(`^[0-9]+$`)
+)
 
 func (m *Migrator) genMigrationName(name string) (string, error) {
 	const timeFormat = "20060102150405"
@@ -314,21 +1133,50 @@ func (m *Migrator) genMigrationName(name string) (string, error) {
 		return "", fmt.Errorf("migrate: invalid migration name: %q", name)
 	}
 
-	version := time.Now().UTC().Format(timeFormat)
+	var version string
+	if m.migrations.nameFunc != nil {
+		version = m.migrations.nameFunc()
+		if !versionRE.MatchString(version) {
+			return "", fmt.Errorf("migrate: invalid migration version: %q", version)
+		}
+	} else {
+		version = time.Now().UTC().Format(timeFormat)
+	}
 	return fmt.Sprintf("%s_%s", version, name), nil
 }
 
 // MarkApplied marks the migration as applied (completed).
 func (m *Migrator) MarkApplied(ctx context.Context, migration *Migration) error {
-	_, err := m.db.NewInsert().Model(migration).
+	if err := m.upgradeTable(ctx); err != nil {
+		return err
+	}
+	return m.markApplied(ctx, m.db, migration)
+}
+
+func (m *Migrator) markApplied(ctx context.Context, db bun.IDB, migration *Migration) error {
+	_, err := db.NewInsert().Model(migration).
 		ModelTableExpr(m.table).
 		Exec(ctx)
 	return err
 }
 
+func (m *Migrator) updateDuration(ctx context.Context, db bun.IDB, migration *Migration) error {
+	_, err := db.NewUpdate().
+		Model(migration).
+		ModelTableExpr(m.table).
+		Column("duration_ms").
+		Where("id = ?", migration.ID).
+		Exec(ctx)
+	return err
+}
+
 // MarkUnapplied marks the migration as unapplied (new).
 func (m *Migrator) MarkUnapplied(ctx context.Context, migration *Migration) error {
-	_, err := m.db.NewDelete().
+	return m.markUnapplied(ctx, m.db, migration)
+}
+
+func (m *Migrator) markUnapplied(ctx context.Context, db bun.IDB, migration *Migration) error {
+	_, err := db.NewDelete().
 		Model(migration).
 		ModelTableExpr(m.table).
 		Where("id = ?", migration.ID).
@@ -372,6 +1220,19 @@ func (m *Migrator) AppliedMigrations(ctx context.Context) (MigrationSlice, error
 	return ms, nil
 }
 
+// uncanceledContext keeps the values of the parent context but is never canceled.
+type uncanceledContext struct {
+	context.Context
+}
+
+func withoutCancel(ctx context.Context) context.Context {
+	return uncanceledContext{Context: ctx}
+}
+
+func (uncanceledContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (uncanceledContext) Done() <-chan struct{}       { return nil }
+func (uncanceledContext) Err() error                  { return nil }
+
 func (m *Migrator) formattedTableName(db *bun.DB) string {
 	return db.Formatter().FormatQuery(m.table)
 }
@@ -380,6 +1241,13 @@ func (m *Migrator) validate() error {
 	if len(m.ms) == 0 {
 		return errors.New("migrate: there are no migrations")
 	}
+	for _, migration := range m.ms {
+		if (migration.Up != nil && migration.UpTx != nil) ||
+			(migration.Down != nil && migration.DownTx != nil) {
+			return fmt.Errorf("migrate: migration %s has both Up and UpTx or Down and DownTx",
+				migration.Name)
+		}
+	}
 	return nil
 }
 
@@ -390,7 +1258,53 @@ type migrationLock struct {
 	TableName string `bun:",unique"`
 }
 
+// Lock locks the migrations so only one Migrator can apply them at a time.
+// See WithLockTimeout to wait for a lock held by another process.
 func (m *Migrator) Lock(ctx context.Context) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	if m.onLock != nil {
+		m.onLock()
+	}
+	return nil
+}
+
+func (m *Migrator) lock(ctx context.Context) error {
+	err := m.tryLock(ctx)
+	if err == nil || m.lockTimeout <= 0 {
+		return err
+	}
+
+	timeout := time.NewTimer(m.lockTimeout)
+	defer timeout.Stop()
+
+	interval := m.lockRetryInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	retry := time.NewTicker(interval)
+	defer retry.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout.C:
+			return fmt.Errorf("%w after %s: %s", ErrLockTimeout, m.lockTimeout, err)
+		case <-retry.C:
+			if err = m.tryLock(ctx); err == nil {
+				return nil
+			}
+		}
+	}
+}
+
+func (m *Migrator) tryLock(ctx context.Context) error {
+	if m.useAdvisoryLock() {
+		return m.advisoryLock(ctx)
+	}
+
 	lock := &migrationLock{
 		TableName: m.formattedTableName(m.db),
 	}
@@ -403,7 +1317,23 @@ func (m *Migrator) Lock(ctx context.Context) error {
 	return nil
 }
 
+// Unlock releases the lock acquired by Lock. The lock is released even if the ctx is
+// already canceled, so Unlock can be deferred with the ctx passed to Migrate.
 func (m *Migrator) Unlock(ctx context.Context) error {
+	if err := m.unlock(withoutCancel(ctx)); err != nil {
+		return err
+	}
+	if m.onUnlock != nil {
+		m.onUnlock()
+	}
+	return nil
+}
+
+func (m *Migrator) unlock(ctx context.Context) error {
+	if m.useAdvisoryLock() {
+		return m.advisoryUnlock(ctx)
+	}
+
 	tableName := m.formattedTableName(m.db)
 	_, err := m.db.NewDelete().
 		Model((*migrationLock)(nil)).
@@ -413,6 +1343,75 @@ func (m *Migrator) Unlock(ctx context.Context) error {
 	return err
 }
 
+func (m *Migrator) isLocked(ctx context.Context) (bool, error) {
+	if m.useAdvisoryLock() {
+		// Advisory locks with a bigint key are stored as two 32-bit halves.
+		key := uint64(m.advisoryLockKey())
+		return m.db.NewSelect().
+			TableExpr("pg_locks").
+			Where("locktype = 'advisory'").
+			Where("classid = ?", uint32(key>>32)).
+			Where("objid = ?", uint32(key)).
+			Where("objsubid = 1").
+			Exists(ctx)
+	}
+
+	return m.db.NewSelect().
+		TableExpr(m.locksTable).
+		Where("? = ?", bun.Ident("table_name"), m.formattedTableName(m.db)).
+		Exists(ctx)
+}
+
+func (m *Migrator) useAdvisoryLock() bool {
+	return m.lockStrategy == AdvisoryLock && m.db.Dialect().Name() == dialect.PG
+}
+
+func (m *Migrator) advisoryLock(ctx context.Context) error {
+	if m.lockConn != nil {
+		return errors.New("migrate: migrations table is already locked")
+	}
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	var locked bool
+	if err := conn.NewRaw(
+		"SELECT pg_try_advisory_lock(?)", m.advisoryLockKey(),
+	).Scan(ctx, &locked); err != nil {
+		_ = conn.Close()
+		return err
+	}
+	if !locked {
+		_ = conn.Close()
+		return errors.New("migrate: migrations table is already locked")
+	}
+
+	m.lockConn = &conn
+	return nil
+}
+
+func (m *Migrator) advisoryUnlock(ctx context.Context) error {
+	conn := m.lockConn
+	if conn == nil {
+		return nil
+	}
+	m.lockConn = nil
+
+	_, err := conn.NewRaw("SELECT pg_advisory_unlock(?)", m.advisoryLockKey()).Exec(ctx)
+	if closeErr := conn.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (m *Migrator) advisoryLockKey() int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(m.formattedTableName(m.db)))
+	return int64(h.Sum64())
+}
+
 func migrationMap(ms MigrationSlice) map[string]*Migration {
 	mp := make(map[string]*Migration)
 	for i := range ms {
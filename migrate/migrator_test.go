@@ -0,0 +1,103 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uptrace/bun"
+)
+
+func TestMigrationNameFunc(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	var n int
+	migrations := NewMigrations(
+		WithMigrationsDirectory(dir),
+		WithMigrationNameFunc(func() string {
+			n++
+			return strconv.Itoa(n)
+		}),
+	)
+	m := NewMigrator(nil, migrations)
+
+	for i := 0; i < 2; i++ {
+		_, err := m.CreateSQLMigrations(ctx, "create_users")
+		require.NoError(t, err)
+	}
+
+	discovered := NewMigrations()
+	err := discovered.Discover(os.DirFS(dir))
+	require.NoError(t, err)
+
+	ms := discovered.Sorted()
+	require.Len(t, ms, 2)
+	require.Equal(t, "1", ms[0].Name)
+	require.Equal(t, "2", ms[1].Name)
+
+	m = NewMigrator(nil, NewMigrations(
+		WithMigrationsDirectory(dir),
+		WithMigrationNameFunc(func() string { return "v1" }),
+	))
+	_, err = m.CreateSQLMigrations(ctx, "create_users")
+	require.EqualError(t, err, `migrate: invalid migration version: "v1"`)
+}
+
+func TestMigrationError(t *testing.T) {
+	cause := errors.New("relation does not exist")
+	err := error(&MigrationError{
+		Name:      "20060102150405",
+		Direction: DirectionDown,
+		GroupID:   3,
+		Err:       cause,
+	})
+
+	require.Equal(t,
+		"migrate: migration 20060102150405 (down) in group #3 failed: relation does not exist",
+		err.Error())
+	require.True(t, errors.Is(err, cause))
+	require.Equal(t, cause, errors.Unwrap(err))
+}
+
+func TestMigrateGroupCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var called bool
+	migrations := MigrationSlice{{
+		Name: "20060102150405",
+		Up: func(ctx context.Context, db *bun.DB) error {
+			called = true
+			return nil
+		},
+	}}
+
+	m := new(Migrator)
+	group := &MigrationGroup{ID: 1}
+	err := m.migrateGroup(ctx, new(migrationConfig), group, migrations)
+	require.ErrorIs(t, err, context.Canceled)
+	require.False(t, called)
+	require.Empty(t, group.Migrations)
+
+	err = m.rollbackGroup(ctx, new(migrationConfig), &MigrationGroup{Migrations: migrations})
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestWithoutCancel(t *testing.T) {
+	type key struct{}
+
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), key{}, 1), time.Hour)
+	cancel()
+
+	ctx = withoutCancel(ctx)
+	require.NoError(t, ctx.Err())
+	require.Nil(t, ctx.Done())
+	_, ok := ctx.Deadline()
+	require.False(t, ok)
+	require.Equal(t, 1, ctx.Value(key{}))
+}
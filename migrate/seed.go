@@ -0,0 +1,100 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/schema"
+)
+
+// Seed inserts the models, for example, a pointer to a slice of structs, and updates
+// the rows that already exist, so reference data can be loaded by a migration that is
+// safe to run more than once:
+//
+//	Up: func(ctx context.Context, db *bun.DB) error {
+//		return migrate.Seed(ctx, db, &[]Status{{ID: 1, Name: "active"}})
+//	},
+//
+// Rows are matched on the primary key or, when the model has none, on its first
+// unique constraint. PostgreSQL and SQLite use ON CONFLICT DO UPDATE and MySQL uses
+// ON DUPLICATE KEY UPDATE. Other dialects are not supported.
+func Seed(ctx context.Context, db bun.IDB, models interface{}) error {
+	table, err := seedTable(db, models)
+	if err != nil {
+		return err
+	}
+
+	conflict := table.PKs
+	if len(conflict) == 0 {
+		conflict = firstUnique(table)
+	}
+	if len(conflict) == 0 {
+		return fmt.Errorf("migrate: %s has no primary key or unique constraint", table.TypeName)
+	}
+
+	q := db.NewInsert().Model(models)
+	switch name := db.Dialect().Name(); name {
+	case dialect.PG, dialect.SQLite:
+		if len(table.DataFields) == 0 {
+			q = q.On("CONFLICT DO NOTHING")
+		} else {
+			q = q.On("CONFLICT (?) DO UPDATE", bun.Safe(joinSQLNames(conflict)))
+		}
+	case dialect.MySQL:
+		if len(table.DataFields) == 0 {
+			q = q.Ignore()
+		} else {
+			q = q.On("DUPLICATE KEY UPDATE")
+		}
+	default:
+		return fmt.Errorf("migrate: Seed does not support %s", name)
+	}
+
+	_, err = q.Exec(ctx)
+	return err
+}
+
+func seedTable(db bun.IDB, models interface{}) (*schema.Table, error) {
+	typ := reflect.TypeOf(models)
+	for typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ != nil && typ.Kind() == reflect.Slice {
+		typ = typ.Elem()
+		if typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("migrate: Seed expects a slice of structs, got %T", models)
+	}
+	return db.Dialect().Tables().Get(typ), nil
+}
+
+// firstUnique returns the fields of the unique constraint with the smallest name.
+func firstUnique(table *schema.Table) []*schema.Field {
+	if len(table.Unique) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(table.Unique))
+	for name := range table.Unique {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return table.Unique[names[0]]
+}
+
+func joinSQLNames(fields []*schema.Field) string {
+	var b []byte
+	for i, f := range fields {
+		if i > 0 {
+			b = append(b, ", "...)
+		}
+		b = append(b, f.SQLName...)
+	}
+	return string(b)
+}
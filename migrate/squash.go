@@ -0,0 +1,282 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/uptrace/bun"
+)
+
+type squashConfig struct {
+	deleteOriginals bool
+}
+
+type SquashOption func(cfg *squashConfig)
+
+// WithDeleteOriginals deletes the files of the squashed migrations from the migrations directory.
+// By default they are kept with the ".orig" suffix so Discover ignores them.
+func WithDeleteOriginals(enabled bool) SquashOption {
+	return func(cfg *squashConfig) {
+		cfg.deleteOriginals = enabled
+	}
+}
+
+// Squash combines the SQL migrations up to and including upTo into a single SQL migration
+// that executes their queries in order. Only SQL migrations can be squashed.
+//
+// The squashed migration keeps the name of upTo, so databases where the squashed migrations
+// are applied already treat it as applied and others apply it as a baseline.
+// If the migrations are applied to the Migrator's database, their rows are replaced with
+// a single row for the squashed migration in the newest of their groups.
+// The original files are renamed with the ".orig" suffix or deleted (see WithDeleteOriginals),
+// so discovering the directory again only finds the squashed migration. The migrations must
+// be discovered from os.DirFS of the migrations directory, and files that run
+// in a transaction (".tx.up.sql") can only be squashed together.
+func (m *Migrator) Squash(ctx context.Context, upTo string, opts ...SquashOption) (Migration, error) {
+	cfg := new(squashConfig)
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if err := m.validate(); err != nil {
+		return Migration{}, err
+	}
+
+	migrations, err := m.MigrationsWithStatus(ctx)
+	if err != nil {
+		return Migration{}, err
+	}
+
+	var squashed MigrationSlice
+	for i := range migrations {
+		if migrations[i].Name <= upTo {
+			squashed = append(squashed, migrations[i])
+		}
+	}
+	if len(squashed) == 0 || squashed[len(squashed)-1].Name != upTo {
+		return Migration{}, fmt.Errorf("migrate: migration %s not found", upTo)
+	}
+
+	var numApplied int
+	for i := range squashed {
+		if squashed[i].upFile == nil {
+			return Migration{}, fmt.Errorf(
+				"migrate: can't squash migration %s: only SQL migrations can be squashed",
+				squashed[i].Name)
+		}
+		if squashed[i].IsApplied() {
+			numApplied++
+		}
+	}
+	if numApplied > 0 && numApplied < len(squashed) {
+		return Migration{}, fmt.Errorf(
+			"migrate: can't squash migrations up to %s: they are partially applied", upTo)
+	}
+	if numApplied > 0 {
+		if err := m.upgradeTable(ctx); err != nil {
+			return Migration{}, err
+		}
+	}
+
+	dir := m.migrations.getDirectory()
+	fsys := os.DirFS(dir)
+
+	var originals []string
+	for i := range squashed {
+		for _, f := range []*sqlMigrationFile{squashed[i].upFile, squashed[i].downFile} {
+			if f == nil {
+				continue
+			}
+			if f.fsys != fsys {
+				return Migration{}, fmt.Errorf(
+					"migrate: can't squash migration %s: it is not discovered from os.DirFS(%q)",
+					squashed[i].Name, dir)
+			}
+			fpath := filepath.Join(dir, f.name)
+			if _, err := os.Stat(fpath); err != nil {
+				return Migration{}, err
+			}
+			originals = append(originals, fpath)
+		}
+	}
+
+	upTx, err := squashedTx(squashed, DirectionUp)
+	if err != nil {
+		return Migration{}, err
+	}
+	downTx, err := squashedTx(squashed, DirectionDown)
+	if err != nil {
+		return Migration{}, err
+	}
+
+	var up, down []string
+
+	for i := range squashed {
+		queries, err := squashed[i].upFile.queries()
+		if err != nil {
+			return Migration{}, err
+		}
+		up = appendSquashed(up, &squashed[i], queries)
+	}
+
+	hasDown := true
+	for i := len(squashed) - 1; i >= 0; i-- {
+		if squashed[i].downFile == nil {
+			hasDown = false
+			break
+		}
+		queries, err := squashed[i].downFile.queries()
+		if err != nil {
+			return Migration{}, err
+		}
+		down = appendSquashed(down, &squashed[i], queries)
+	}
+
+	last := squashed[len(squashed)-1]
+	migration := Migration{
+		Name:       upTo,
+		Comment:    "squashed",
+		MigratedAt: last.MigratedAt,
+	}
+	for i := range squashed {
+		if squashed[i].GroupID > migration.GroupID {
+			migration.GroupID = squashed[i].GroupID
+		}
+		migration.DurationMS += squashed[i].DurationMS
+	}
+
+	// The originals are moved first, so a failure at any step below can be undone
+	// and the directory never contains both the originals and the squashed migration.
+	var moved []string
+	var written []string
+	undo := func() {
+		for _, fpath := range written {
+			_ = os.Remove(fpath)
+		}
+		for _, fpath := range moved {
+			_ = os.Rename(fpath+".orig", fpath)
+		}
+	}
+
+	for _, fpath := range originals {
+		if err := os.Rename(fpath, fpath+".orig"); err != nil {
+			undo()
+			return Migration{}, err
+		}
+		moved = append(moved, fpath)
+	}
+
+	upName := squashedName(upTo, DirectionUp, upTx)
+	if err := writeSquashed(dir, upName, up); err != nil {
+		undo()
+		return Migration{}, err
+	}
+	written = append(written, filepath.Join(dir, upName))
+	migration.Up = NewSQLMigrationFunc(fsys, upName)
+	migration.upFile = &sqlMigrationFile{fsys: fsys, name: upName}
+
+	if hasDown {
+		downName := squashedName(upTo, DirectionDown, downTx)
+		if err := writeSquashed(dir, downName, down); err != nil {
+			undo()
+			return Migration{}, err
+		}
+		written = append(written, filepath.Join(dir, downName))
+		migration.Down = NewSQLMigrationFunc(fsys, downName)
+		migration.downFile = &sqlMigrationFile{fsys: fsys, name: downName}
+	}
+
+	if numApplied > 0 {
+		if err := m.replaceApplied(ctx, squashed, &migration); err != nil {
+			undo()
+			return Migration{}, err
+		}
+	}
+
+	if cfg.deleteOriginals {
+		for _, fpath := range moved {
+			if err := os.Remove(fpath + ".orig"); err != nil {
+				return Migration{}, err
+			}
+		}
+	}
+
+	m.migrations.replace(squashed, migration)
+	return migration, nil
+}
+
+// squashedTx reports whether the squashed migration file for the direction
+// must run in a transaction. Files that run in a transaction (".tx.up.sql")
+// can't be squashed together with files that don't.
+func squashedTx(squashed MigrationSlice, direction Direction) (bool, error) {
+	var numTx, numFiles int
+	for i := range squashed {
+		f := squashed[i].upFile
+		if direction == DirectionDown {
+			f = squashed[i].downFile
+		}
+		if f == nil {
+			continue
+		}
+		numFiles++
+		if isTxMigrationFile(f.name) {
+			numTx++
+		}
+	}
+	if numTx > 0 && numTx < numFiles {
+		return false, fmt.Errorf(
+			"migrate: can't squash migrations: only some of the %s files use transactions",
+			direction)
+	}
+	return numTx > 0, nil
+}
+
+func squashedName(upTo string, direction Direction, tx bool) string {
+	name := upTo + "_squashed"
+	if tx {
+		name += ".tx"
+	}
+	return name + "." + direction.String() + ".sql"
+}
+
+// replaceApplied replaces the rows of the squashed migrations in the migrations table
+// with a single row for the migration. The row is added to the newest group
+// of the squashed migrations, so rolling back that group rolls back all of them.
+func (m *Migrator) replaceApplied(
+	ctx context.Context, squashed MigrationSlice, migration *Migration,
+) error {
+	names := make([]string, len(squashed))
+	for i := range squashed {
+		names[i] = squashed[i].Name
+	}
+
+	return m.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewDelete().
+			Model((*Migration)(nil)).
+			ModelTableExpr(m.table).
+			Where("? IN (?)", bun.Ident("name"), bun.In(names)).
+			Exec(ctx); err != nil {
+			return err
+		}
+		return m.markApplied(ctx, tx, migration)
+	})
+}
+
+func appendSquashed(queries []string, migration *Migration, src []string) []string {
+	for i, q := range src {
+		if i == 0 {
+			q = "-- " + migration.String() + "\n" + q
+		}
+		queries = append(queries, q)
+	}
+	return queries
+}
+
+func writeSquashed(dir, fname string, queries []string) error {
+	content := strings.Join(queries, "--bun:split\n")
+	return ioutil.WriteFile(filepath.Join(dir, fname), []byte(content), 0o644)
+}